@@ -15,335 +15,429 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/computer": {
-            "get": {
-                "description": "Returns a list of computer instances",
+        "/admin/computer/{id}": {
+            "delete": {
+                "description": "Removes a computer for good, whether deleted or not",
                 "tags": [
-                    "Computer"
+                    "Admin"
+                ],
+                "summary": "Computer purging",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Computer ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "Computer list",
                 "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/computer.Computer"
-                            }
-                        }
+                    "204": {
+                        "description": "No Content"
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     }
                 }
-            },
-            "post": {
-                "description": "Adds a new computer instance",
-                "consumes": [
-                    "application/json"
-                ],
+            }
+        },
+        "/admin/dlq": {
+            "get": {
+                "description": "Lists the dead-letter queues of a bus with their depth",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Computer"
+                    "Admin"
                 ],
-                "summary": "Computer creation",
+                "summary": "Dead-letter queues",
                 "parameters": [
                     {
-                        "description": "Computer object",
-                        "name": "computer",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/handler.ComputerReq"
-                        }
+                        "type": "string",
+                        "description": "Bus; defaults to the first available one that keeps dead letters",
+                        "name": "transport",
+                        "in": "query"
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/computer.Computer"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/bus.DeadLetterQueue"
+                            }
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "500": {
+                        "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "503": {
+                        "description": "Service Unavailable",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     }
                 }
             }
         },
-        "/computer/kafka": {
-            "post": {
-                "description": "Creates a computer instance via kafka",
-                "consumes": [
-                    "application/json"
-                ],
+        "/admin/dlq/{queue}": {
+            "get": {
+                "description": "Returns dead-lettered messages of a queue without removing them",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Kafka"
+                    "Admin"
                 ],
-                "summary": "Computer creation through kafka",
+                "summary": "Dead letters inspection",
                 "parameters": [
                     {
-                        "description": "Computer object",
-                        "name": "computer",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/handler.ComputerReq"
-                        }
+                        "type": "string",
+                        "description": "Work queue name",
+                        "name": "queue",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bus; defaults to the first available one that keeps dead letters",
+                        "name": "transport",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of messages (default 10, max 100)",
+                        "name": "limit",
+                        "in": "query"
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/bus.DeadLetter"
+                            }
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     }
                 }
             }
         },
-        "/computer/kafka/{id}": {
-            "put": {
-                "description": "Updates a computer instance via kafka",
+        "/admin/dlq/{queue}/replay": {
+            "post": {
+                "description": "Moves dead-lettered messages back to their work queue with a fresh attempt count",
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "Kafka"
+                    "Admin"
                 ],
-                "summary": "Computer update through kafka",
+                "summary": "Dead letters replay",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Computer ID",
-                        "name": "id",
+                        "description": "Work queue name",
+                        "name": "queue",
                         "in": "path",
                         "required": true
                     },
                     {
-                        "description": "Computer object",
-                        "name": "computer",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/handler.ComputerReq"
-                        }
+                        "type": "string",
+                        "description": "Bus; defaults to the first available one that keeps dead letters",
+                        "name": "transport",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of messages (default 10, max 100)",
+                        "name": "limit",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/handler.ReplayResp"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     }
                 }
-            },
+            }
+        },
+        "/admin/user/{id}": {
             "delete": {
-                "description": "Deletes a computer instance via kafka",
+                "description": "Removes a user for good, whether deleted or not",
                 "tags": [
-                    "Kafka"
+                    "Admin"
                 ],
-                "summary": "Computer deletion through kafka",
+                "summary": "User purging",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Computer ID",
+                        "description": "User ID",
                         "name": "id",
                         "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "$ref": "#/definitions/responder.Response"
-                        }
+                    "204": {
+                        "description": "No Content"
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     }
                 }
             }
         },
-        "/computer/rabbit": {
-            "post": {
-                "description": "Creates a computer instance via RabbitMQ",
-                "consumes": [
-                    "application/json"
-                ],
+        "/commands/{id}": {
+            "get": {
+                "description": "Returns the status of a command accepted by an async endpoint, with the resulting entity id or error",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "RabbitMQ"
+                    "Command"
                 ],
-                "summary": "Computer creation through RabbitMQ",
+                "summary": "Async command status",
                 "parameters": [
                     {
-                        "description": "Computer object",
-                        "name": "computer",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/handler.ComputerReq"
-                        }
+                        "type": "string",
+                        "description": "Command ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/command.Command"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     }
                 }
             }
         },
-        "/computer/rabbit/{id}": {
-            "put": {
-                "description": "Updates a computer instance via RabbitMQ",
+        "/computer": {
+            "get": {
+                "description": "Returns a page of computer instances",
                 "tags": [
-                    "RabbitMQ"
+                    "Computer"
                 ],
-                "summary": "Computer update through RabbitMQ",
+                "summary": "Computer list",
                 "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 20, max 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
                     {
                         "type": "string",
-                        "description": "Computer ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Next page token from a previous response",
+                        "name": "cursor",
+                        "in": "query"
                     },
                     {
-                        "description": "Computer object",
-                        "name": "computer",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/handler.ComputerReq"
-                        }
+                        "type": "string",
+                        "description": "Sort field: id, ip, manufacturer, cpu or os; prefix with - for descending",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Manufacturer filter",
+                        "name": "manufacturer",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "OS filter",
+                        "name": "os",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "CPU filter",
+                        "name": "cpu",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "IP prefix filter",
+                        "name": "ip",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Owner filter",
+                        "name": "ownerId",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/computer.Page"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     }
                 }
             },
-            "delete": {
-                "description": "Deletes a computer instance via RabbitMQ",
+            "post": {
+                "description": "Adds a new computer instance",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "RabbitMQ"
+                    "Computer"
                 ],
-                "summary": "Computer deletion through RabbitMQ",
+                "summary": "Computer creation",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Computer ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Computer object",
+                        "name": "computer",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.ComputerReq"
+                        }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "201": {
+                        "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/computer.Computer"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     }
                 }
@@ -370,30 +464,42 @@ const docTemplate = `{
                         "description": "OK",
                         "schema": {
                             "$ref": "#/definitions/computer.Computer"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the computer"
+                            }
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     },
                     "404": {
                         "description": "Not Found",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     }
                 }
             },
             "put": {
-                "description": "Updates a computer instance",
+                "description": "Updates a computer instance if it is still at the version named by If-Match.\nThe owner is replaced too: omitting ownerId unassigns the computer.",
                 "consumes": [
                     "application/json"
                 ],
@@ -412,6 +518,13 @@ const docTemplate = `{
                         "in": "path",
                         "required": true
                     },
+                    {
+                        "type": "string",
+                        "description": "ETag of the computer, or * to overwrite any version",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
                     {
                         "description": "Computer object",
                         "name": "computer",
@@ -427,18 +540,48 @@ const docTemplate = `{
                         "description": "OK",
                         "schema": {
                             "$ref": "#/definitions/computer.Computer"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "New version of the computer"
+                            }
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "428": {
+                        "description": "Precondition Required",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     }
                 }
@@ -468,132 +611,208 @@ const docTemplate = `{
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     }
                 }
-            }
-        },
-        "/user": {
-            "post": {
-                "description": "Adds a new user instance",
+            },
+            "patch": {
+                "description": "Updates the given fields of a computer instance with a JSON merge patch or a JSON Patch.\nWithout If-Match, merge patches apply to any version and JSON Patches to the version they were applied to.",
                 "consumes": [
-                    "application/json"
+                    "application/merge-patch+json",
+                    "application/json-patch+json"
                 ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "User"
+                    "Computer"
                 ],
-                "summary": "User creataion",
+                "summary": "Computer partial update",
                 "parameters": [
                     {
-                        "description": "User object",
-                        "name": "userData",
+                        "type": "string",
+                        "description": "Computer ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the computer",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Merge patch, or a JSON Patch array",
+                        "name": "patch",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/handler.UserReq"
+                            "$ref": "#/definitions/handler.ComputerReq"
                         }
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/user.User"
+                            "$ref": "#/definitions/computer.Computer"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "New version of the computer"
+                            }
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     }
                 }
             }
         },
-        "/user/kafka": {
-            "post": {
-                "description": "Adds a new user instance via kafka",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
+        "/computer/{id}/history": {
+            "get": {
+                "description": "Returns a page of the changes to a computer, newest first, with the computer before and after each change, who made it and through what.\nThe history of purged computers is kept.",
                 "tags": [
-                    "Kafka"
+                    "Computer"
                 ],
-                "summary": "User creation through kafka",
+                "summary": "Computer history",
                 "parameters": [
                     {
-                        "description": "User object",
-                        "name": "userData",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/handler.UserReq"
-                        }
+                        "type": "string",
+                        "description": "Computer ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 20, max 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Next page token from a previous response",
+                        "name": "cursor",
+                        "in": "query"
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/audit.Page"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     }
                 }
             }
         },
-        "/user/kafka/{id}": {
+        "/computer/{id}/owner": {
             "put": {
-                "description": "Updates a user instance via kafka",
+                "description": "Assigns a computer, deleted or not, to a user, or unassigns it if ownerId is empty.\nWithout If-Match, it applies to any version of the computer.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "Kafka"
+                    "Computer"
                 ],
-                "summary": "User update through kafka",
+                "summary": "Computer owner",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "User ID",
+                        "description": "Computer ID",
                         "name": "id",
                         "in": "path",
                         "required": true
                     },
                     {
-                        "description": "User object",
-                        "name": "userData",
+                        "type": "string",
+                        "description": "ETag of the computer",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "New owner",
+                        "name": "owner",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/handler.UserReq"
+                            "$ref": "#/definitions/handler.OwnerReq"
                         }
                     }
                 ],
@@ -601,33 +820,59 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/computer.Computer"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "New version of the computer"
+                            }
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "Malformed request, or the user does not exist or is deleted",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "Deletes a user instance via kafka",
+            }
+        },
+        "/computer/{id}/restore": {
+            "post": {
+                "description": "Undoes the deletion of a computer",
                 "tags": [
-                    "Kafka"
+                    "Computer"
                 ],
-                "summary": "User deletion through kafka",
+                "summary": "Computer restoring",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "User ID",
+                        "description": "Computer ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -637,27 +882,45 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/computer.Computer"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "New version of the computer"
+                            }
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "The computer is not deleted",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     }
                 }
             }
         },
-        "/user/rabbit": {
+        "/computer/{transport}": {
             "post": {
-                "description": "Adds a new user instance via RabbitMQ",
+                "description": "Creates a computer instance via the given bus",
                 "consumes": [
                     "application/json"
                 ],
@@ -665,251 +928,1216 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "RabbitMQ"
+                    "Bus"
                 ],
-                "summary": "User creation through RabbitMQ",
+                "summary": "Computer creation through a message bus",
                 "parameters": [
                     {
-                        "description": "User object",
-                        "name": "userData",
+                        "enum": [
+                            "kafka",
+                            "rabbit",
+                            "nats",
+                            "memory"
+                        ],
+                        "type": "string",
+                        "description": "Bus",
+                        "name": "transport",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Computer object",
+                        "name": "computer",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/handler.UserReq"
+                            "$ref": "#/definitions/handler.ComputerReq"
                         }
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
-                        "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/command.Command"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "/commands/{id}"
+                            }
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     }
                 }
             }
         },
-        "/user/rabbit/{id}": {
+        "/computer/{transport}/{id}": {
             "put": {
-                "description": "Updates a user instance via RabbitMQ",
+                "description": "Updates a computer instance via the given bus",
                 "tags": [
-                    "RabbitMQ"
+                    "Bus"
                 ],
-                "summary": "User update through RabbitMQ",
+                "summary": "Computer update through a message bus",
                 "parameters": [
                     {
+                        "enum": [
+                            "kafka",
+                            "rabbit",
+                            "nats",
+                            "memory"
+                        ],
                         "type": "string",
-                        "description": "User ID",
+                        "description": "Bus",
+                        "name": "transport",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Computer ID",
                         "name": "id",
                         "in": "path",
                         "required": true
                     },
                     {
-                        "description": "User object",
-                        "name": "userData",
+                        "type": "string",
+                        "description": "ETag of the computer, or * to overwrite any version",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Computer object",
+                        "name": "computer",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/handler.UserReq"
+                            "$ref": "#/definitions/handler.ComputerReq"
                         }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/command.Command"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "/commands/{id}"
+                            }
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "428": {
+                        "description": "Precondition Required",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     }
                 }
             },
             "delete": {
-                "description": "Deletes a user instance via RabbitMQ",
+                "description": "Deletes a computer instance via the given bus",
                 "tags": [
-                    "RabbitMQ"
+                    "Bus"
                 ],
-                "summary": "User deletion through RabbitMQ",
+                "summary": "Computer deletion through a message bus",
                 "parameters": [
                     {
+                        "enum": [
+                            "kafka",
+                            "rabbit",
+                            "nats",
+                            "memory"
+                        ],
                         "type": "string",
-                        "description": "User ID",
+                        "description": "Bus",
+                        "name": "transport",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Computer ID",
                         "name": "id",
                         "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/command.Command"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "/commands/{id}"
+                            }
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     }
                 }
-            }
-        },
-        "/user/{id}": {
-            "get": {
-                "description": "Returns a user instance",
+            },
+            "patch": {
+                "description": "Applies a JSON merge patch or a JSON Patch to the current computer and sends the patched fields via the given bus",
+                "consumes": [
+                    "application/merge-patch+json",
+                    "application/json-patch+json"
+                ],
                 "tags": [
-                    "User"
+                    "Bus"
                 ],
-                "summary": "User reading",
+                "summary": "Computer partial update through a message bus",
                 "parameters": [
                     {
+                        "enum": [
+                            "kafka",
+                            "rabbit",
+                            "nats",
+                            "memory"
+                        ],
                         "type": "string",
-                        "description": "User ID",
+                        "description": "Bus",
+                        "name": "transport",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Computer ID",
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the computer",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Merge patch, or a JSON Patch array",
+                        "name": "patch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.ComputerReq"
+                        }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "$ref": "#/definitions/user.User"
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/command.Command"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "/commands/{id}"
+                            }
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     },
                     "404": {
                         "description": "Not Found",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "409": {
+                        "description": "Conflict",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
-                    }
-                }
-            },
-            "put": {
-                "description": "Updates a user instance",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "User"
-                ],
-                "summary": "User update",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "User ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
                     },
-                    {
-                        "description": "User object",
-                        "name": "userData",
-                        "in": "body",
-                        "required": true,
+                    "410": {
+                        "description": "Gone",
                         "schema": {
-                            "$ref": "#/definitions/handler.UserReq"
+                            "$ref": "#/definitions/responder.Problem"
                         }
-                    }
-                ],
-                "responses": {
-                    "200": {
-                        "description": "OK",
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
                         "schema": {
-                            "$ref": "#/definitions/user.User"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "415": {
+                        "description": "Unsupported Media Type",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "Deletes a user instance",
+            }
+        },
+        "/user": {
+            "get": {
+                "description": "Returns a page of user instances with the total number of matches",
                 "tags": [
                     "User"
                 ],
-                "summary": "User deletion",
+                "summary": "User list",
                 "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 20, max 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
                     {
                         "type": "string",
-                        "description": "User ID",
-                        "name": "id",
+                        "description": "Next page token from a previous response",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sort field: id, name, age or email; prefix with - for descending",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Name substring",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Email substring",
+                        "name": "email",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Minimum age",
+                        "name": "minAge",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum age",
+                        "name": "maxAge",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Include soft-deleted users",
+                        "name": "includeDeleted",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.Page"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Adds a new user instance",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User"
+                ],
+                "summary": "User creataion",
+                "parameters": [
+                    {
+                        "description": "User object",
+                        "name": "userData",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.UserReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/user.User"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}": {
+            "get": {
+                "description": "Returns a user instance",
+                "tags": [
+                    "User"
+                ],
+                "summary": "User reading",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the user"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Updates a user instance if it is still at the version named by If-Match",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User"
+                ],
+                "summary": "User update",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the user, or * to overwrite any version",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "User object",
+                        "name": "userData",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.UserReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "New version of the user"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "428": {
+                        "description": "Precondition Required",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes a user instance. Its computers are given to the user reassignTo, or unassigned, shortly after.",
+                "tags": [
+                    "User"
+                ],
+                "summary": "User deletion",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "User to give the computers of the deleted user to; they are unassigned otherwise",
+                        "name": "reassignTo",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.User"
+                        }
+                    },
+                    "400": {
+                        "description": "Malformed request, or reassignTo does not exist or is deleted",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Updates the given fields of a user instance with a JSON merge patch or a JSON Patch.\nWithout If-Match, merge patches apply to any version and JSON Patches to the version they were applied to.",
+                "consumes": [
+                    "application/merge-patch+json",
+                    "application/json-patch+json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User"
+                ],
+                "summary": "User partial update",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the user",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Merge patch, or a JSON Patch array",
+                        "name": "patch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.UserReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "New version of the user"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}/computers": {
+            "get": {
+                "description": "Returns a page of the computers assigned to a user",
+                "tags": [
+                    "User"
+                ],
+                "summary": "User computers",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 20, max 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Next page token from a previous response",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sort field: id, ip, manufacturer, cpu or os; prefix with - for descending",
+                        "name": "sort",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/computer.Page"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}/history": {
+            "get": {
+                "description": "Returns a page of the changes to a user, newest first, with the user before and after each change, who made it and through what.\nThe history of purged users is kept.",
+                "tags": [
+                    "User"
+                ],
+                "summary": "User history",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 20, max 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Next page token from a previous response",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/audit.Page"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{id}/restore": {
+            "post": {
+                "description": "Undoes the deletion of a user",
+                "tags": [
+                    "User"
+                ],
+                "summary": "User restoring",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/user.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "New version of the user"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "The user is not deleted, or its email is taken",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{transport}": {
+            "post": {
+                "description": "Adds a new user instance via the given bus",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Bus"
+                ],
+                "summary": "User creation through a message bus",
+                "parameters": [
+                    {
+                        "enum": [
+                            "kafka",
+                            "rabbit",
+                            "nats",
+                            "memory"
+                        ],
+                        "type": "string",
+                        "description": "Bus",
+                        "name": "transport",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "User object",
+                        "name": "userData",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.UserReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/command.Command"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "/commands/{id}"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/user/{transport}/{id}": {
+            "put": {
+                "description": "Updates a user instance via the given bus",
+                "tags": [
+                    "Bus"
+                ],
+                "summary": "User update through a message bus",
+                "parameters": [
+                    {
+                        "enum": [
+                            "kafka",
+                            "rabbit",
+                            "nats",
+                            "memory"
+                        ],
+                        "type": "string",
+                        "description": "Bus",
+                        "name": "transport",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the user, or * to overwrite any version",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "User object",
+                        "name": "userData",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.UserReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/command.Command"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "/commands/{id}"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "428": {
+                        "description": "Precondition Required",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes a user instance via the given bus",
+                "tags": [
+                    "Bus"
+                ],
+                "summary": "User deletion through a message bus",
+                "parameters": [
+                    {
+                        "enum": [
+                            "kafka",
+                            "rabbit",
+                            "nats",
+                            "memory"
+                        ],
+                        "type": "string",
+                        "description": "Bus",
+                        "name": "transport",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "User to give the computers of the deleted user to; they are unassigned otherwise",
+                        "name": "reassignTo",
+                        "in": "query"
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/command.Command"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "/commands/{id}"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/user.User"
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Applies a JSON merge patch or a JSON Patch to the current user and sends the patched fields via the given bus",
+                "consumes": [
+                    "application/merge-patch+json",
+                    "application/json-patch+json"
+                ],
+                "tags": [
+                    "Bus"
+                ],
+                "summary": "User partial update through a message bus",
+                "parameters": [
+                    {
+                        "enum": [
+                            "kafka",
+                            "rabbit",
+                            "nats",
+                            "memory"
+                        ],
+                        "type": "string",
+                        "description": "Bus",
+                        "name": "transport",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the user",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Merge patch, or a JSON Patch array",
+                        "name": "patch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.UserReq"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/command.Command"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "/commands/{id}"
+                            }
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/responder.Response"
+                            "$ref": "#/definitions/responder.Problem"
                         }
                     }
                 }
@@ -917,8 +2145,175 @@ const docTemplate = `{
         }
     },
     "definitions": {
+        "audit.Action": {
+            "type": "string",
+            "enum": [
+                "created",
+                "updated",
+                "deleted",
+                "restored",
+                "purged"
+            ],
+            "x-enum-varnames": [
+                "ActionCreated",
+                "ActionUpdated",
+                "ActionDeleted",
+                "ActionRestored",
+                "ActionPurged"
+            ]
+        },
+        "audit.Entry": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "$ref": "#/definitions/audit.Action"
+                },
+                "actor": {
+                    "type": "string"
+                },
+                "after": {
+                    "type": "object",
+                    "additionalProperties": {}
+                },
+                "before": {
+                    "type": "object",
+                    "additionalProperties": {}
+                },
+                "changedAt": {
+                    "type": "string"
+                },
+                "entity": {
+                    "type": "string"
+                },
+                "entityId": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "messageId": {
+                    "type": "string"
+                },
+                "requestId": {
+                    "description": "RequestID is the correlation id of the request behind the change and\nMessageID the id of the command message that applied it, if any.",
+                    "type": "string"
+                },
+                "source": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "integer"
+                }
+            }
+        },
+        "audit.Page": {
+            "type": "object",
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/audit.Entry"
+                    }
+                },
+                "nextCursor": {
+                    "type": "string"
+                }
+            }
+        },
+        "bus.DeadLetter": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "body": {
+                    "type": "string"
+                },
+                "contentType": {
+                    "type": "string"
+                },
+                "deadLetteredAt": {
+                    "type": "string"
+                },
+                "headers": {
+                    "type": "object",
+                    "additionalProperties": {}
+                },
+                "lastError": {
+                    "type": "string"
+                },
+                "messageId": {
+                    "type": "string"
+                },
+                "queue": {
+                    "type": "string"
+                }
+            }
+        },
+        "bus.DeadLetterQueue": {
+            "type": "object",
+            "properties": {
+                "deadLetterQueue": {
+                    "type": "string"
+                },
+                "messages": {
+                    "type": "integer"
+                },
+                "queue": {
+                    "type": "string"
+                }
+            }
+        },
+        "command.Command": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "entityId": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "status": {
+                    "$ref": "#/definitions/command.Status"
+                },
+                "type": {
+                    "type": "string"
+                },
+                "updatedAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "command.Status": {
+            "type": "string",
+            "enum": [
+                "pending",
+                "succeeded",
+                "failed"
+            ],
+            "x-enum-varnames": [
+                "StatusPending",
+                "StatusSucceeded",
+                "StatusFailed"
+            ]
+        },
         "computer.Computer": {
             "type": "object",
+            "required": [
+                "cpu",
+                "gpu",
+                "hdd",
+                "ip",
+                "manufacturer",
+                "os",
+                "ram"
+            ],
             "properties": {
                 "_id": {
                     "type": "string"
@@ -926,6 +2321,17 @@ const docTemplate = `{
                 "cpu": {
                     "type": "string"
                 },
+                "createdAt": {
+                    "description": "CreatedAt and UpdatedAt are set by the repository. Updates include\ndeleting and restoring.",
+                    "type": "string"
+                },
+                "deletedAt": {
+                    "description": "DeletedAt and DeletedBy tell when and by whom a deleted computer was\ndeleted.",
+                    "type": "string"
+                },
+                "deletedBy": {
+                    "type": "string"
+                },
                 "gpu": {
                     "type": "string"
                 },
@@ -942,15 +2348,67 @@ const docTemplate = `{
                     "type": "string"
                 },
                 "os": {
+                    "type": "string",
+                    "enum": [
+                        "Windows",
+                        "Linux",
+                        "macOS",
+                        "FreeBSD",
+                        "ChromeOS"
+                    ]
+                },
+                "ownerId": {
+                    "description": "OwnerID is the id of the user the computer is assigned to, if any.\nUsers are kept in Postgres, so nothing but the services keeps it\npointing at one that is not deleted.",
                     "type": "string"
                 },
                 "ram": {
                     "type": "string"
+                },
+                "updatedAt": {
+                    "type": "string"
+                },
+                "version": {
+                    "description": "Version counts the writes to the computer. An update carrying a\nnon-zero version only applies to that version.",
+                    "type": "integer"
+                }
+            }
+        },
+        "computer.Page": {
+            "type": "object",
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/computer.Computer"
+                    }
+                },
+                "nextCursor": {
+                    "type": "string"
+                }
+            }
+        },
+        "errs.FieldError": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
                 }
             }
         },
         "handler.ComputerReq": {
             "type": "object",
+            "required": [
+                "cpu",
+                "gpu",
+                "hdd",
+                "ip",
+                "manufacturer",
+                "os",
+                "ram"
+            ],
             "properties": {
                 "cpu": {
                     "type": "string"
@@ -968,6 +2426,17 @@ const docTemplate = `{
                     "type": "string"
                 },
                 "os": {
+                    "type": "string",
+                    "enum": [
+                        "Windows",
+                        "Linux",
+                        "macOS",
+                        "FreeBSD",
+                        "ChromeOS"
+                    ]
+                },
+                "ownerId": {
+                    "description": "OwnerID is the user owning the computer, none if empty.",
                     "type": "string"
                 },
                 "ram": {
@@ -975,41 +2444,117 @@ const docTemplate = `{
                 }
             }
         },
+        "handler.OwnerReq": {
+            "type": "object",
+            "properties": {
+                "ownerId": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.ReplayResp": {
+            "type": "object",
+            "properties": {
+                "replayed": {
+                    "type": "integer"
+                }
+            }
+        },
         "handler.UserReq": {
             "type": "object",
+            "required": [
+                "age",
+                "email",
+                "name"
+            ],
             "properties": {
                 "age": {
-                    "type": "integer"
+                    "type": "integer",
+                    "maximum": 150,
+                    "minimum": 1
                 },
                 "email": {
-                    "type": "string"
+                    "type": "string",
+                    "maxLength": 100
                 },
                 "name": {
-                    "type": "string"
+                    "type": "string",
+                    "maxLength": 50
                 }
             }
         },
-        "responder.Response": {
+        "responder.Problem": {
             "type": "object",
             "properties": {
-                "code": {
+                "detail": {
+                    "type": "string"
+                },
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/errs.FieldError"
+                    }
+                },
+                "instance": {
+                    "type": "string"
+                },
+                "status": {
                     "type": "integer"
                 },
-                "contentType": {
+                "title": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "user.Page": {
+            "type": "object",
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/user.User"
+                    }
+                },
+                "nextCursor": {
                     "type": "string"
                 },
-                "payload": {}
+                "total": {
+                    "type": "integer"
+                }
             }
         },
         "user.User": {
             "type": "object",
+            "required": [
+                "age",
+                "email",
+                "id",
+                "name"
+            ],
             "properties": {
                 "age": {
-                    "type": "integer"
+                    "type": "integer",
+                    "maximum": 150,
+                    "minimum": 1
                 },
-                "email": {
+                "createdAt": {
+                    "description": "CreatedAt and UpdatedAt are set by the database. Updates include\ndeleting and restoring.",
+                    "type": "string"
+                },
+                "deletedAt": {
+                    "description": "DeletedAt and DeletedBy tell when and by whom a deleted user was\ndeleted.",
+                    "type": "string"
+                },
+                "deletedBy": {
                     "type": "string"
                 },
+                "email": {
+                    "type": "string",
+                    "maxLength": 100
+                },
                 "id": {
                     "type": "string"
                 },
@@ -1017,7 +2562,15 @@ const docTemplate = `{
                     "type": "boolean"
                 },
                 "name": {
+                    "type": "string",
+                    "maxLength": 50
+                },
+                "updatedAt": {
                     "type": "string"
+                },
+                "version": {
+                    "description": "Version counts the writes to the user. An update carrying a non-zero\nversion only applies to that version.",
+                    "type": "integer"
                 }
             }
         }
@@ -2,8 +2,14 @@ package app
 
 import (
 	"practice/internal/controller"
+	"practice/internal/kafka"
+	"practice/internal/nats"
+	"practice/internal/ownership"
+	"practice/internal/pipeline"
 	"practice/internal/rabbitmq"
+	"practice/internal/relay"
 	"practice/internal/repository"
+	"practice/internal/retention"
 	"practice/internal/service"
 
 	"go.uber.org/fx"
@@ -16,5 +22,11 @@ func New(opt fx.Option) *fx.App {
 		service.Module,
 		controller.Module,
 		rabbitmq.Module,
+		kafka.Module,
+		nats.Module,
+		pipeline.Module,
+		relay.Module,
+		retention.Module,
+		ownership.Module,
 	)
 }
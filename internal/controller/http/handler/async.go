@@ -0,0 +1,442 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"practice/internal/controller/http/responder"
+	"practice/internal/pipeline"
+	"practice/internal/pkg/codec"
+	"practice/internal/pkg/outbox"
+	"practice/internal/pkg/validator"
+	"practice/internal/repository/mongodb/computer"
+	"practice/internal/repository/postgres/user"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BusPath is the path segment of the async endpoints of transport, mounted
+// under /user and /computer.
+func BusPath(transport string) string {
+	if transport == outbox.TransportRabbitMQ {
+		return "rabbit"
+	}
+	return transport
+}
+
+// CreateUserAsync godoc
+// @Summary User creation through a message bus
+// @Description Adds a new user instance via the given bus
+// @Tags Bus
+// @Router /user/{transport} [post]
+// @Accept			json
+// @Produce			json
+// @Param transport path string true "Bus" Enums(kafka, rabbit, nats, memory)
+// @Param userData body UserReq true "User object"
+// @Success 202 {object} command.Command
+// @Header 202 {string} Location "/commands/{id}"
+// @Failure 400 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
+func (h *Handler) CreateUserAsync(transport string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		var (
+			req      UserReq
+			response = &responder.Response{}
+		)
+		defer responder.Send(w, r, response)
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.logger.Error(fmt.Sprintf("wrong body format: %v", err))
+			responder.WrongBodyFormat(response, err)
+			return
+		}
+
+		if err := validator.Struct(req); err != nil {
+			h.logger.Error(fmt.Sprintf("invalid request: %v", err))
+			responder.Error(response, err)
+			return
+		}
+
+		msg := user.User{
+			ID:        uuid.NewString(),
+			Name:      req.Name,
+			Age:       req.Age,
+			Email:     req.Email,
+			IsDeleted: false,
+		}
+
+		cmd, err := h.pipeline.Send(ctx, transport, pipeline.CreateUser, msg.ID, msg)
+		if err != nil {
+			h.logger.Error(fmt.Sprintf("request failed: %v", err))
+			responder.Error(response, err)
+			return
+		}
+
+		accepted(response, cmd)
+	}
+}
+
+// UpdateUserAsync godoc
+// @Summary User update through a message bus
+// @Description Updates a user instance via the given bus
+// @Tags Bus
+// @Router /user/{transport}/{id} [put]
+// @Param transport path string true "Bus" Enums(kafka, rabbit, nats, memory)
+// @Param id path string true "User ID"
+// @Param If-Match header string true "ETag of the user, or * to overwrite any version"
+// @Param userData body UserReq true "User object"
+// @Success 202 {object} command.Command
+// @Header 202 {string} Location "/commands/{id}"
+// @Failure 400 {object} responder.Problem
+// @Failure 412 {object} responder.Problem
+// @Failure 428 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
+func (h *Handler) UpdateUserAsync(transport string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		var (
+			req      UserReq
+			response = &responder.Response{}
+		)
+		defer responder.Send(w, r, response)
+
+		id := chi.URLParam(r, "id")
+
+		version, ok := ifMatch(response, r)
+		if !ok {
+			h.logger.Error("missing or invalid If-Match")
+			return
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.logger.Error(fmt.Sprintf("wrong body format: %v", err))
+			responder.WrongBodyFormat(response, err)
+			return
+		}
+
+		if err := validator.Struct(req); err != nil {
+			h.logger.Error(fmt.Sprintf("invalid request: %v", err))
+			responder.Error(response, err)
+			return
+		}
+
+		msg := user.User{
+			ID:      id,
+			Name:    req.Name,
+			Age:     req.Age,
+			Email:   req.Email,
+			Version: version,
+		}
+
+		cmd, err := h.pipeline.Send(ctx, transport, pipeline.UpdateUser, id, msg)
+		if err != nil {
+			h.logger.Error(fmt.Sprintf("request failed: %v", err))
+			responder.Error(response, err)
+			return
+		}
+
+		accepted(response, cmd)
+	}
+}
+
+// PatchUserAsync godoc
+// @Summary User partial update through a message bus
+// @Description Applies a JSON merge patch or a JSON Patch to the current user and sends the patched fields via the given bus
+// @Tags Bus
+// @Router /user/{transport}/{id} [patch]
+// @Accept			application/merge-patch+json,application/json-patch+json
+// @Param transport path string true "Bus" Enums(kafka, rabbit, nats, memory)
+// @Param id path string true "User ID"
+// @Param If-Match header string false "ETag of the user"
+// @Param patch body UserReq true "Merge patch, or a JSON Patch array"
+// @Success 202 {object} command.Command
+// @Header 202 {string} Location "/commands/{id}"
+// @Failure 400 {object} responder.Problem
+// @Failure 404 {object} responder.Problem
+// @Failure 409 {object} responder.Problem
+// @Failure 410 {object} responder.Problem
+// @Failure 412 {object} responder.Problem
+// @Failure 415 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
+func (h *Handler) PatchUserAsync(transport string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		response := &responder.Response{}
+		defer responder.Send(w, r, response)
+
+		patch, ok := h.userPatch(ctx, response, r)
+		if !ok {
+			return
+		}
+
+		cmd, err := h.pipeline.Send(ctx, transport, pipeline.PatchUser, patch.ID, patch)
+		if err != nil {
+			h.logger.Error(fmt.Sprintf("request failed: %v", err))
+			responder.Error(response, err)
+			return
+		}
+
+		accepted(response, cmd)
+	}
+}
+
+// DeleteUserAsync godoc
+// @Summary User deletion through a message bus
+// @Description Deletes a user instance via the given bus
+// @Tags Bus
+// @Router /user/{transport}/{id} [delete]
+// @Param transport path string true "Bus" Enums(kafka, rabbit, nats, memory)
+// @Param id path string true "User ID"
+// @Param reassignTo query string false "User to give the computers of the deleted user to; they are unassigned otherwise"
+// @Success 202 {object} command.Command
+// @Header 202 {string} Location "/commands/{id}"
+// @Failure 400 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
+func (h *Handler) DeleteUserAsync(transport string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		var response responder.Response
+		defer responder.Send(w, r, &response)
+
+		id := chi.URLParam(r, "id")
+
+		cmd, err := h.pipeline.Send(ctx, transport, pipeline.DeleteUser, id, codec.Delete{
+			ID:         id,
+			ReassignTo: r.URL.Query().Get("reassignTo"),
+		})
+		if err != nil {
+			h.logger.Error(fmt.Sprintf("request failed: %v", err))
+			responder.Error(&response, err)
+			return
+		}
+
+		accepted(&response, cmd)
+	}
+}
+
+// CreateComputerAsync godoc
+// @Summary Computer creation through a message bus
+// @Description Creates a computer instance via the given bus
+// @Tags Bus
+// @Router /computer/{transport} [post]
+// @Accept			json
+// @Produce			json
+// @Param transport path string true "Bus" Enums(kafka, rabbit, nats, memory)
+// @Param computer body ComputerReq true "Computer object"
+// @Success 202 {object} command.Command
+// @Header 202 {string} Location "/commands/{id}"
+// @Failure 400 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
+func (h *Handler) CreateComputerAsync(transport string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		var (
+			req      ComputerReq
+			response = &responder.Response{}
+		)
+		defer responder.Send(w, r, response)
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.logger.Error(fmt.Sprintf("wrong body format: %v", err))
+			responder.WrongBodyFormat(response, err)
+			return
+		}
+
+		if err := validator.Struct(req); err != nil {
+			h.logger.Error(fmt.Sprintf("invalid request: %v", err))
+			responder.Error(response, err)
+			return
+		}
+
+		id := primitive.NewObjectID()
+
+		msg := computer.Computer{
+			ID:           &id,
+			IP:           req.IP,
+			Manufacturer: req.Manufacturer,
+			CPU:          req.CPU,
+			RAM:          req.RAM,
+			HDD:          req.HDD,
+			GPU:          req.GPU,
+			OS:           req.OS,
+			OwnerID:      req.OwnerID,
+			IsDeleted:    false,
+		}
+
+		cmd, err := h.pipeline.Send(ctx, transport, pipeline.CreateComputer, id.Hex(), msg)
+		if err != nil {
+			h.logger.Error(fmt.Sprintf("request failed: %v", err))
+			responder.Error(response, err)
+			return
+		}
+
+		accepted(response, cmd)
+	}
+}
+
+// UpdateComputerAsync godoc
+// @Summary Computer update through a message bus
+// @Description Updates a computer instance via the given bus
+// @Tags Bus
+// @Router /computer/{transport}/{id} [put]
+// @Param transport path string true "Bus" Enums(kafka, rabbit, nats, memory)
+// @Param id path string true "Computer ID"
+// @Param If-Match header string true "ETag of the computer, or * to overwrite any version"
+// @Param computer body ComputerReq true "Computer object"
+// @Success 202 {object} command.Command
+// @Header 202 {string} Location "/commands/{id}"
+// @Failure 400 {object} responder.Problem
+// @Failure 412 {object} responder.Problem
+// @Failure 428 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
+func (h *Handler) UpdateComputerAsync(transport string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		var (
+			req      ComputerReq
+			response = &responder.Response{}
+		)
+		defer responder.Send(w, r, response)
+
+		idStr := chi.URLParam(r, "id")
+
+		id, err := primitive.ObjectIDFromHex(idStr)
+		if err != nil {
+			h.logger.Error(fmt.Sprintf("wrong body format: %v", err))
+			responder.WrongBodyFormat(response, err)
+			return
+		}
+
+		version, ok := ifMatch(response, r)
+		if !ok {
+			h.logger.Error("missing or invalid If-Match")
+			return
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.logger.Error(fmt.Sprintf("wrong body format: %v", err))
+			responder.WrongBodyFormat(response, err)
+			return
+		}
+
+		if err := validator.Struct(req); err != nil {
+			h.logger.Error(fmt.Sprintf("invalid request: %v", err))
+			responder.Error(response, err)
+			return
+		}
+
+		msg := computer.Computer{
+			ID:           &id,
+			IP:           req.IP,
+			Manufacturer: req.Manufacturer,
+			CPU:          req.CPU,
+			RAM:          req.RAM,
+			HDD:          req.HDD,
+			GPU:          req.GPU,
+			OS:           req.OS,
+			OwnerID:      req.OwnerID,
+			Version:      version,
+		}
+
+		cmd, err := h.pipeline.Send(ctx, transport, pipeline.UpdateComputer, idStr, msg)
+		if err != nil {
+			h.logger.Error(fmt.Sprintf("request failed: %v", err))
+			responder.Error(response, err)
+			return
+		}
+
+		accepted(response, cmd)
+	}
+}
+
+// PatchComputerAsync godoc
+// @Summary Computer partial update through a message bus
+// @Description Applies a JSON merge patch or a JSON Patch to the current computer and sends the patched fields via the given bus
+// @Tags Bus
+// @Router /computer/{transport}/{id} [patch]
+// @Accept			application/merge-patch+json,application/json-patch+json
+// @Param transport path string true "Bus" Enums(kafka, rabbit, nats, memory)
+// @Param id path string true "Computer ID"
+// @Param If-Match header string false "ETag of the computer"
+// @Param patch body ComputerReq true "Merge patch, or a JSON Patch array"
+// @Success 202 {object} command.Command
+// @Header 202 {string} Location "/commands/{id}"
+// @Failure 400 {object} responder.Problem
+// @Failure 404 {object} responder.Problem
+// @Failure 409 {object} responder.Problem
+// @Failure 410 {object} responder.Problem
+// @Failure 412 {object} responder.Problem
+// @Failure 415 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
+func (h *Handler) PatchComputerAsync(transport string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		response := &responder.Response{}
+		defer responder.Send(w, r, response)
+
+		patch, ok := h.computerPatch(ctx, response, r)
+		if !ok {
+			return
+		}
+
+		cmd, err := h.pipeline.Send(ctx, transport, pipeline.PatchComputer, patch.ID.Hex(), patch)
+		if err != nil {
+			h.logger.Error(fmt.Sprintf("request failed: %v", err))
+			responder.Error(response, err)
+			return
+		}
+
+		accepted(response, cmd)
+	}
+}
+
+// DeleteComputerAsync godoc
+// @Summary Computer deletion through a message bus
+// @Description Deletes a computer instance via the given bus
+// @Tags Bus
+// @Router /computer/{transport}/{id} [delete]
+// @Param transport path string true "Bus" Enums(kafka, rabbit, nats, memory)
+// @Param id path string true "Computer ID"
+// @Success 202 {object} command.Command
+// @Header 202 {string} Location "/commands/{id}"
+// @Failure 400 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
+func (h *Handler) DeleteComputerAsync(transport string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		var response responder.Response
+		defer responder.Send(w, r, &response)
+
+		id := chi.URLParam(r, "id")
+
+		cmd, err := h.pipeline.Send(ctx, transport, pipeline.DeleteComputer, id, codec.Delete{ID: id})
+		if err != nil {
+			h.logger.Error(fmt.Sprintf("request failed: %v", err))
+			responder.Error(&response, err)
+			return
+		}
+
+		accepted(&response, cmd)
+	}
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"practice/internal/controller/http/responder"
+	"practice/internal/pkg/errs"
+
+	"github.com/go-chi/chi"
+)
+
+// GetCommand godoc
+// @Summary Async command status
+// @Description Returns the status of a command accepted by an async endpoint, with the resulting entity id or error
+// @Tags Command
+// @Router /commands/{id} [get]
+// @Produce json
+// @Param id path string true "Command ID"
+// @Success 200 {object} command.Command
+// @Failure 404 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
+func (h *Handler) GetCommand(w http.ResponseWriter, r *http.Request) {
+	var response responder.Response
+	defer responder.Send(w, r, &response)
+
+	id := chi.URLParam(r, "id")
+
+	// A command lives in the database of the aggregate it targets.
+	cmd, err := h.userCommands.Get(r.Context(), id)
+	if errs.Is(err, errs.KindNotFound) {
+		cmd, err = h.computerCommands.Get(r.Context(), id)
+	}
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(&response, err)
+		return
+	}
+
+	response.Code = http.StatusOK
+	response.Payload = cmd
+	response.ContentType = "application/json"
+}
@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"net/http"
 	"practice/internal/controller/http/responder"
+	"practice/internal/pkg/validator"
 	"practice/internal/repository/mongodb/computer"
+	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -21,8 +24,9 @@ import (
 // @Produce			json
 // @Param computer body ComputerReq true "Computer object"
 // @Success 201 {object} computer.Computer
-// @Failure 400 {object} responder.Response
-// @Failure 500 {object} responder.Response
+// @Failure 400 {object} responder.Problem
+// @Failure 409 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
 func (h *Handler) CreateComputer(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithCancel(r.Context())
 	defer cancel()
@@ -32,7 +36,7 @@ func (h *Handler) CreateComputer(w http.ResponseWriter, r *http.Request) {
 		response = &responder.Response{}
 	)
 
-	defer responder.Send(w, response)
+	defer responder.Send(w, r, response)
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.logger.Error(fmt.Sprintf("wrong body format: %v", err))
@@ -40,6 +44,12 @@ func (h *Handler) CreateComputer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := validator.Struct(req); err != nil {
+		h.logger.Error(fmt.Sprintf("invalid request: %v", err))
+		responder.Error(response, err)
+		return
+	}
+
 	res, err := h.serviceComputer.Create(ctx, &computer.Computer{
 		IP:           req.IP,
 		Manufacturer: req.Manufacturer,
@@ -48,11 +58,12 @@ func (h *Handler) CreateComputer(w http.ResponseWriter, r *http.Request) {
 		HDD:          req.HDD,
 		GPU:          req.GPU,
 		OS:           req.OS,
+		OwnerID:      req.OwnerID,
 		IsDeleted:    false,
 	})
 	if err != nil {
-		h.logger.Error(fmt.Sprintf("internal server error: %v", err))
-		responder.InternalServerError(response, err)
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(response, err)
 		return
 	}
 
@@ -67,41 +78,51 @@ func (h *Handler) CreateComputer(w http.ResponseWriter, r *http.Request) {
 // @Router /computer/{id} [get]
 // @Param id path string true "Computer ID"
 // @Success 200 {object} computer.Computer
-// @Failure 400 {object} responder.Response
-// @Failure 404 {object} responder.Response
-// @Failure 500 {object} responder.Response
+// @Header 200 {string} ETag "Version of the computer"
+// @Failure 400 {object} responder.Problem
+// @Failure 404 {object} responder.Problem
+// @Failure 410 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
 func (h *Handler) GetComputer(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithCancel(r.Context())
 	defer cancel()
 
 	var response responder.Response
-	defer responder.Send(w, &response)
+	defer responder.Send(w, r, &response)
 
 	id := chi.URLParam(r, "id")
 
 	res, err := h.serviceComputer.Read(ctx, id)
 	if err != nil {
-		h.logger.Error(fmt.Sprintf("internal server error: %v", err))
-		responder.InternalServerError(&responder.Response{}, err)
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(&response, err)
 		return
 	}
 
+	withETag(&response, res.Version)
 	response.Code = http.StatusOK
 	response.Payload = res
 	response.ContentType = "application/json"
 }
 
 // @Summary Computer update
-// @Description Updates a computer instance
+// @Description Updates a computer instance if it is still at the version named by If-Match.
+// @Description The owner is replaced too: omitting ownerId unassigns the computer.
 // @Tags Computer
 // @Router /computer/{id} [put]
 // @Accept			json
 // @Produce			json
 // @Param id path string true "Computer ID"
+// @Param If-Match header string true "ETag of the computer, or * to overwrite any version"
 // @Param computer body ComputerReq true "Computer object"
 // @Success 200 {object} computer.Computer
-// @Failure 400 {object} responder.Response
-// @Failure 500 {object} responder.Response
+// @Header 200 {string} ETag "New version of the computer"
+// @Failure 400 {object} responder.Problem
+// @Failure 404 {object} responder.Problem
+// @Failure 410 {object} responder.Problem
+// @Failure 412 {object} responder.Problem
+// @Failure 428 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
 func (h *Handler) UpdateComputer(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithCancel(r.Context())
 	defer cancel()
@@ -111,7 +132,7 @@ func (h *Handler) UpdateComputer(w http.ResponseWriter, r *http.Request) {
 		response = &responder.Response{}
 	)
 
-	defer responder.Send(w, response)
+	defer responder.Send(w, r, response)
 
 	idStr := chi.URLParam(r, "id")
 
@@ -122,14 +143,25 @@ func (h *Handler) UpdateComputer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	version, ok := ifMatch(response, r)
+	if !ok {
+		h.logger.Error("missing or invalid If-Match")
+		return
+	}
+
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.logger.Error(fmt.Sprintf("wrong body format: %v", err))
 		responder.WrongBodyFormat(response, err)
 		return
 	}
 
-	h.logger.Info("body: ", req)
-	res, err := h.serviceComputer.Update(ctx, &computer.Computer{
+	if err := validator.Struct(req); err != nil {
+		h.logger.Error(fmt.Sprintf("invalid request: %v", err))
+		responder.Error(response, err)
+		return
+	}
+
+	comp := &computer.Computer{
 		ID:           &id,
 		IP:           req.IP,
 		Manufacturer: req.Manufacturer,
@@ -138,18 +170,136 @@ func (h *Handler) UpdateComputer(w http.ResponseWriter, r *http.Request) {
 		HDD:          req.HDD,
 		GPU:          req.GPU,
 		OS:           req.OS,
-	})
+		OwnerID:      req.OwnerID,
+		Version:      version,
+	}
+
+	res, err := h.serviceComputer.Update(ctx, comp)
 	if err != nil {
-		h.logger.Error(fmt.Sprintf("internal server error: %v", err))
-		responder.InternalServerError(response, err)
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(response, err)
 		return
 	}
 
+	withETag(response, comp.Version)
 	response.Code = http.StatusOK
 	response.Payload = res
 	response.ContentType = "application/json"
 }
 
+// PatchComputer godoc
+// @Summary Computer partial update
+// @Description Updates the given fields of a computer instance with a JSON merge patch or a JSON Patch.
+// @Description Without If-Match, merge patches apply to any version and JSON Patches to the version they were applied to.
+// @Tags Computer
+// @Router /computer/{id} [patch]
+// @Accept			application/merge-patch+json,application/json-patch+json
+// @Produce			json
+// @Param id path string true "Computer ID"
+// @Param If-Match header string false "ETag of the computer"
+// @Param patch body ComputerReq true "Merge patch, or a JSON Patch array"
+// @Success 200 {object} computer.Computer
+// @Header 200 {string} ETag "New version of the computer"
+// @Failure 400 {object} responder.Problem
+// @Failure 404 {object} responder.Problem
+// @Failure 409 {object} responder.Problem
+// @Failure 410 {object} responder.Problem
+// @Failure 412 {object} responder.Problem
+// @Failure 415 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
+func (h *Handler) PatchComputer(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	response := &responder.Response{}
+	defer responder.Send(w, r, response)
+
+	patch, ok := h.computerPatch(ctx, response, r)
+	if !ok {
+		return
+	}
+
+	if _, err := h.serviceComputer.Patch(ctx, patch); err != nil {
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(response, err)
+		return
+	}
+
+	withETag(response, patch.Version)
+	response.Code = http.StatusOK
+	response.Payload = &patch.Computer
+	response.ContentType = "application/json"
+}
+
+// computerPatch applies the PATCH body of r to the current computer and
+// returns the validated result, or fills response and returns false.
+func (h *Handler) computerPatch(ctx context.Context, response *responder.Response, r *http.Request) (*computer.Patch, bool) {
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("wrong body format: %v", err))
+		responder.WrongBodyFormat(response, err)
+		return nil, false
+	}
+
+	version, ok := ifMatchOptional(response, r)
+	if !ok {
+		h.logger.Error("invalid If-Match")
+		return nil, false
+	}
+
+	p, ok := readPatch(response, r)
+	if !ok {
+		h.logger.Error("unsupported or malformed patch")
+		return nil, false
+	}
+
+	current, err := h.serviceComputer.Read(ctx, id.Hex())
+	if err == nil {
+		err = checkVersion("computer", version, current.Version)
+	}
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(response, err)
+		return nil, false
+	}
+
+	var req ComputerReq
+	err = p.apply(ComputerReq{
+		IP:           current.IP,
+		Manufacturer: current.Manufacturer,
+		CPU:          current.CPU,
+		RAM:          current.RAM,
+		HDD:          current.HDD,
+		GPU:          current.GPU,
+		OS:           current.OS,
+		OwnerID:      current.OwnerID,
+	}, &req)
+	if err == nil {
+		err = validator.Struct(req)
+	}
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("invalid request: %v", err))
+		responder.Error(response, err)
+		return nil, false
+	}
+
+	return &computer.Patch{
+		Computer: computer.Computer{
+			ID:           &id,
+			IP:           req.IP,
+			Manufacturer: req.Manufacturer,
+			CPU:          req.CPU,
+			RAM:          req.RAM,
+			HDD:          req.HDD,
+			GPU:          req.GPU,
+			OS:           req.OS,
+			OwnerID:      req.OwnerID,
+			Version:      p.version(version, current.Version),
+		},
+		Fields: p.fields,
+	}, true
+}
+
 // DeleteComputer godoc
 // @Summary Computer deletion
 // @Description Deletes a computer instance
@@ -157,21 +307,23 @@ func (h *Handler) UpdateComputer(w http.ResponseWriter, r *http.Request) {
 // @Router /computer/{id} [delete]
 // @Param id path string true "Computer ID"
 // @Success 200 {object} string
-// @Failure 400 {object} responder.Response
-// @Failure 500 {object} responder.Response
+// @Failure 400 {object} responder.Problem
+// @Failure 404 {object} responder.Problem
+// @Failure 410 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
 func (h *Handler) DeleteComputer(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithCancel(r.Context())
 	defer cancel()
 
 	var response responder.Response
-	defer responder.Send(w, &response)
+	defer responder.Send(w, r, &response)
 
 	id := chi.URLParam(r, "id")
 
 	id, err := h.serviceComputer.Delete(ctx, id)
 	if err != nil {
-		h.logger.Error(fmt.Sprintf("internal server error: %v", err))
-		responder.InternalServerError(&responder.Response{}, err)
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(&response, err)
 		return
 	}
 
@@ -180,25 +332,197 @@ func (h *Handler) DeleteComputer(w http.ResponseWriter, r *http.Request) {
 	response.ContentType = "application/json"
 }
 
+// AssignComputer godoc
+// @Summary Computer owner
+// @Description Assigns a computer, deleted or not, to a user, or unassigns it if ownerId is empty.
+// @Description Without If-Match, it applies to any version of the computer.
+// @Tags Computer
+// @Router /computer/{id}/owner [put]
+// @Accept			json
+// @Produce			json
+// @Param id path string true "Computer ID"
+// @Param If-Match header string false "ETag of the computer"
+// @Param owner body OwnerReq true "New owner"
+// @Success 200 {object} computer.Computer
+// @Header 200 {string} ETag "New version of the computer"
+// @Failure 400 {object} responder.Problem "Malformed request, or the user does not exist or is deleted"
+// @Failure 404 {object} responder.Problem
+// @Failure 410 {object} responder.Problem
+// @Failure 412 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
+func (h *Handler) AssignComputer(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	var (
+		req      OwnerReq
+		response = &responder.Response{}
+	)
+
+	defer responder.Send(w, r, response)
+
+	version, ok := ifMatchOptional(response, r)
+	if !ok {
+		h.logger.Error("invalid If-Match")
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error(fmt.Sprintf("wrong body format: %v", err))
+		responder.WrongBodyFormat(response, err)
+		return
+	}
+
+	if err := validator.Struct(req); err != nil {
+		h.logger.Error(fmt.Sprintf("invalid request: %v", err))
+		responder.Error(response, err)
+		return
+	}
+
+	res, err := h.serviceComputer.Assign(ctx, chi.URLParam(r, "id"), req.OwnerID, version)
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(response, err)
+		return
+	}
+
+	withETag(response, res.Version)
+	response.Code = http.StatusOK
+	response.Payload = res
+	response.ContentType = "application/json"
+}
+
+// @Summary Computer restoring
+// @Description Undoes the deletion of a computer
+// @Tags Computer
+// @Router /computer/{id}/restore [post]
+// @Param id path string true "Computer ID"
+// @Success 200 {object} computer.Computer
+// @Header 200 {string} ETag "New version of the computer"
+// @Failure 400 {object} responder.Problem
+// @Failure 404 {object} responder.Problem
+// @Failure 409 {object} responder.Problem "The computer is not deleted"
+// @Failure 500 {object} responder.Problem
+func (h *Handler) RestoreComputer(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	var response responder.Response
+	defer responder.Send(w, r, &response)
+
+	res, err := h.serviceComputer.Restore(ctx, chi.URLParam(r, "id"))
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(&response, err)
+		return
+	}
+
+	withETag(&response, res.Version)
+	response.Code = http.StatusOK
+	response.Payload = res
+	response.ContentType = "application/json"
+}
+
+// @Summary Computer purging
+// @Description Removes a computer for good, whether deleted or not
+// @Tags Admin
+// @Router /admin/computer/{id} [delete]
+// @Param id path string true "Computer ID"
+// @Success 204
+// @Failure 400 {object} responder.Problem
+// @Failure 404 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
+func (h *Handler) PurgeComputer(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	var response responder.Response
+	defer responder.Send(w, r, &response)
+
+	if err := h.serviceComputer.Purge(ctx, chi.URLParam(r, "id")); err != nil {
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(&response, err)
+		return
+	}
+
+	response.Code = http.StatusNoContent
+}
+
+// GetComputerHistory godoc
+// @Summary Computer history
+// @Description Returns a page of the changes to a computer, newest first, with the computer before and after each change, who made it and through what.
+// @Description The history of purged computers is kept.
+// @Tags Computer
+// @Router /computer/{id}/history [get]
+// @Param id path string true "Computer ID"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param cursor query string false "Next page token from a previous response"
+// @Success 200 {object} audit.Page
+// @Failure 400 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
+func (h *Handler) GetComputerHistory(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	var response responder.Response
+	defer responder.Send(w, r, &response)
+
+	params, ok := h.historyParams(&response, r)
+	if !ok {
+		return
+	}
+
+	res, err := h.serviceComputer.History(ctx, chi.URLParam(r, "id"), params)
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(&response, err)
+		return
+	}
+
+	response.Code = http.StatusOK
+	response.Payload = res
+	response.ContentType = "application/json"
+}
+
 // ListComputers godoc
 // @Summary Computer list
-// @Description Returns a list of computer instances
+// @Description Returns a page of computer instances
 // @Tags Computer
 // @Router /computer [get]
-// @Success 200 {object} []computer.Computer
-// @Failure 400 {object} responder.Response
-// @Failure 500 {object} responder.Response
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param cursor query string false "Next page token from a previous response"
+// @Param sort query string false "Sort field: id, ip, manufacturer, cpu or os; prefix with - for descending"
+// @Param manufacturer query string false "Manufacturer filter"
+// @Param os query string false "OS filter"
+// @Param cpu query string false "CPU filter"
+// @Param ip query string false "IP prefix filter"
+// @Param ownerId query string false "Owner filter"
+// @Success 200 {object} computer.Page
+// @Failure 400 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
 func (h *Handler) ListComputers(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithCancel(r.Context())
 	defer cancel()
 
 	var response responder.Response
-	defer responder.Send(w, &response)
+	defer responder.Send(w, r, &response)
+
+	query := r.URL.Query()
+
+	params, ok := h.computerListParams(&response, r)
+	if !ok {
+		return
+	}
+	params.Manufacturer = query.Get("manufacturer")
+	params.OS = query.Get("os")
+	params.CPU = query.Get("cpu")
+	params.IPPrefix = query.Get("ip")
+	params.OwnerID = query.Get("ownerId")
 
-	res, err := h.serviceComputer.GetAll(ctx)
+	res, err := h.serviceComputer.List(ctx, params)
 	if err != nil {
-		h.logger.Error(fmt.Sprintf("internal server error: %v", err))
-		responder.InternalServerError(&responder.Response{}, err)
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(&response, err)
 		return
 	}
 
@@ -206,3 +530,28 @@ func (h *Handler) ListComputers(w http.ResponseWriter, r *http.Request) {
 	response.Payload = res
 	response.ContentType = "application/json"
 }
+
+// computerListParams reads the paging and sorting parameters of a computer
+// listing from r, or fills response and returns false.
+func (h *Handler) computerListParams(response *responder.Response, r *http.Request) (*computer.ListParams, bool) {
+	query := r.URL.Query()
+
+	params := &computer.ListParams{Cursor: query.Get("cursor")}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			h.logger.Error(fmt.Sprintf("bad request: %v", err))
+			responder.BadRequest(response, err)
+			return nil, false
+		}
+		params.Limit = n
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		params.SortBy = strings.TrimPrefix(sort, "-")
+		params.SortDesc = strings.HasPrefix(sort, "-")
+	}
+
+	return params, true
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"practice/internal/controller/http/responder"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+const (
+	defaultDeadLetterLimit = 10
+	maxDeadLetterLimit     = 100
+)
+
+var errDeadLettersUnavailable = errors.New("no available bus keeps dead letters")
+
+// ListDeadLetterQueues godoc
+// @Summary Dead-letter queues
+// @Description Lists the dead-letter queues of a bus with their depth
+// @Tags Admin
+// @Router /admin/dlq [get]
+// @Produce json
+// @Param transport query string false "Bus; defaults to the first available one that keeps dead letters"
+// @Success 200 {array} bus.DeadLetterQueue
+// @Failure 500 {object} responder.Problem
+// @Failure 503 {object} responder.Problem
+func (h *Handler) ListDeadLetterQueues(w http.ResponseWriter, r *http.Request) {
+	var response responder.Response
+	defer responder.Send(w, r, &response)
+
+	deadLetters, ok := h.buses.DeadLetters(r.URL.Query().Get("transport"))
+	if !ok {
+		responder.Unavailable(&response, errDeadLettersUnavailable)
+		return
+	}
+
+	res, err := deadLetters.DeadLetterQueues()
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(&response, err)
+		return
+	}
+
+	response.Code = http.StatusOK
+	response.Payload = res
+	response.ContentType = "application/json"
+}
+
+// GetDeadLetters godoc
+// @Summary Dead letters inspection
+// @Description Returns dead-lettered messages of a queue without removing them
+// @Tags Admin
+// @Router /admin/dlq/{queue} [get]
+// @Produce json
+// @Param queue path string true "Work queue name"
+// @Param transport query string false "Bus; defaults to the first available one that keeps dead letters"
+// @Param limit query int false "Maximum number of messages (default 10, max 100)"
+// @Success 200 {array} bus.DeadLetter
+// @Failure 400 {object} responder.Problem
+// @Failure 404 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
+// @Failure 503 {object} responder.Problem
+func (h *Handler) GetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	var response responder.Response
+	defer responder.Send(w, r, &response)
+
+	deadLetters, ok := h.buses.DeadLetters(r.URL.Query().Get("transport"))
+	if !ok {
+		responder.Unavailable(&response, errDeadLettersUnavailable)
+		return
+	}
+
+	limit, err := deadLetterLimit(r)
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("bad request: %v", err))
+		responder.BadRequest(&response, err)
+		return
+	}
+
+	res, err := deadLetters.PeekDeadLetters(chi.URLParam(r, "queue"), limit)
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(&response, err)
+		return
+	}
+
+	response.Code = http.StatusOK
+	response.Payload = res
+	response.ContentType = "application/json"
+}
+
+// ReplayDeadLetters godoc
+// @Summary Dead letters replay
+// @Description Moves dead-lettered messages back to their work queue with a fresh attempt count
+// @Tags Admin
+// @Router /admin/dlq/{queue}/replay [post]
+// @Produce json
+// @Param queue path string true "Work queue name"
+// @Param transport query string false "Bus; defaults to the first available one that keeps dead letters"
+// @Param limit query int false "Maximum number of messages (default 10, max 100)"
+// @Success 200 {object} ReplayResp
+// @Failure 400 {object} responder.Problem
+// @Failure 404 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
+// @Failure 503 {object} responder.Problem
+func (h *Handler) ReplayDeadLetters(w http.ResponseWriter, r *http.Request) {
+	var response responder.Response
+	defer responder.Send(w, r, &response)
+
+	deadLetters, ok := h.buses.DeadLetters(r.URL.Query().Get("transport"))
+	if !ok {
+		responder.Unavailable(&response, errDeadLettersUnavailable)
+		return
+	}
+
+	limit, err := deadLetterLimit(r)
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("bad request: %v", err))
+		responder.BadRequest(&response, err)
+		return
+	}
+
+	n, err := deadLetters.ReplayDeadLetters(chi.URLParam(r, "queue"), limit)
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(&response, err)
+		return
+	}
+
+	response.Code = http.StatusOK
+	response.Payload = ReplayResp{Replayed: n}
+	response.ContentType = "application/json"
+}
+
+type ReplayResp struct {
+	Replayed int `json:"replayed"`
+}
+
+func deadLetterLimit(r *http.Request) (int, error) {
+	val := r.URL.Query().Get("limit")
+	if val == "" {
+		return defaultDeadLetterLimit, nil
+	}
+
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, err
+	}
+
+	if n < 1 || n > maxDeadLetterLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxDeadLetterLimit)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"practice/internal/controller/http/responder"
+	"practice/internal/pkg/errs"
+	"strconv"
+	"strings"
+)
+
+// etag is the entity tag of the given version of a user or computer.
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// ifMatch returns the version a write is conditioned on by its If-Match
+// header, 0 for "*", which matches any version. Writes without the header
+// are answered with 428 and tags that are not one of ours with 412, in
+// which case ok is false.
+func ifMatch(response *responder.Response, r *http.Request) (version int, ok bool) {
+	if r.Header.Get("If-Match") == "" {
+		responder.PreconditionRequired(response)
+		return 0, false
+	}
+	return ifMatchOptional(response, r)
+}
+
+// ifMatchOptional is ifMatch for writes that may be unconditional, for
+// which a missing header yields 0.
+func ifMatchOptional(response *responder.Response, r *http.Request) (version int, ok bool) {
+	tag := strings.TrimSpace(r.Header.Get("If-Match"))
+	if tag == "" || tag == "*" {
+		return 0, true
+	}
+
+	unquoted, err := strconv.Unquote(tag)
+	if err == nil && strings.HasPrefix(tag, `"`) {
+		if version, err = strconv.Atoi(unquoted); err == nil && version > 0 {
+			return version, true
+		}
+	}
+
+	responder.Error(response, errs.PreconditionFailed("If-Match does not name a version: "+tag))
+	return 0, false
+}
+
+// checkVersion fails with 412 semantics if version is set and the entity
+// read for a patch is at another one.
+func checkVersion(entity string, version, current int) error {
+	if version != 0 && version != current {
+		return errs.PreconditionFailed(fmt.Sprintf("%s is at version %d, not %d", entity, current, version))
+	}
+	return nil
+}
+
+// withETag adds the entity tag of version to response.
+func withETag(response *responder.Response, version int) {
+	if response.Headers == nil {
+		response.Headers = http.Header{}
+	}
+	response.Headers.Set("ETag", etag(version))
+}
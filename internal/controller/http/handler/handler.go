@@ -1,15 +1,17 @@
 package handler
 
 import (
-	"log"
 	"log/slog"
-	kafkaCons "practice/internal/kafka/consumer"
-	kafkaProd "practice/internal/kafka/producer"
+	"net/http"
+	"practice/internal/controller/http/responder"
+	"practice/internal/pipeline"
+	"practice/internal/pkg/bus"
+	"practice/internal/pkg/command"
 	"practice/internal/pkg/config"
-	rabbitmqCons "practice/internal/rabbitmq/consumer"
-	rabbitmqProd "practice/internal/rabbitmq/producer"
 	"practice/internal/repository/mongodb"
+	mongoCommand "practice/internal/repository/mongodb/command"
 	"practice/internal/repository/postgres"
+	pgCommand "practice/internal/repository/postgres/command"
 	"practice/internal/service/computer"
 	"practice/internal/service/user"
 
@@ -17,27 +19,16 @@ import (
 )
 
 type Handler struct {
-	cfg                  *config.Config
-	logger               *slog.Logger
-	repositoryPostgres   *postgres.Postgres
-	repositoryMongo      *mongodb.MongoDB
-	serviceUser          user.ServiceUser
-	serviceComputer      computer.ServiceComputer
-	kafkaProducer        kafkaProd.IKafkaProducer
-	rabbitProducer       *rabbitmqProd.MsgBroker
-	rabbitConsumer       *rabbitmqCons.MsgBroker
-	topicUserCreated     string
-	topicUserUpdated     string
-	topicUserDeleted     string
-	topicComputerCreated string
-	topicComputerUpdated string
-	topicComputerDeleted string
-	queueUserCreated     string
-	queueUserUpdated     string
-	queueUserDeleted     string
-	queueComputerCreated string
-	queueComputerUpdated string
-	queueComputerDeleted string
+	cfg                *config.Config
+	logger             *slog.Logger
+	repositoryPostgres *postgres.Postgres
+	repositoryMongo    *mongodb.MongoDB
+	serviceUser        user.ServiceUser
+	serviceComputer    computer.ServiceComputer
+	userCommands       command.Store
+	computerCommands   command.Store
+	pipeline           *pipeline.Pipeline
+	buses              *bus.Registry
 }
 
 type Options struct {
@@ -48,67 +39,60 @@ type Options struct {
 	RepositoryMongo    *mongodb.MongoDB
 	ServiceUser        user.ServiceUser
 	ServiceComputer    computer.ServiceComputer
-	RabbitmqProducer   *rabbitmqProd.MsgBroker
-	RabbitmqConsumer   *rabbitmqCons.MsgBroker
+	UserCommands       pgCommand.RepositoryCommand
+	ComputerCommands   mongoCommand.RepositoryCommand
+	Pipeline           *pipeline.Pipeline
+	Buses              *bus.Registry
 }
 
 var Module = fx.Provide(New)
 
 func New(opts Options) *Handler {
-	consumers := map[string]func([]byte){
-		opts.Cfg.KAFKA_TOPIC_USER_CREATED:     kafkaCons.ConsumeCreateUser(opts.Cfg, opts.ServiceUser),
-		opts.Cfg.KAFKA_TOPIC_USER_UPDATED:     kafkaCons.ConsumeUpdateUser(opts.Cfg, opts.ServiceUser),
-		opts.Cfg.KAFKA_TOPIC_USER_DELETED:     kafkaCons.ConsumeDeleteUser(opts.Cfg, opts.ServiceUser),
-		opts.Cfg.KAFKA_TOPIC_COMPUTER_CREATED: kafkaCons.ConsumeCreateComputer(opts.Cfg, opts.ServiceComputer),
-		opts.Cfg.KAFKA_TOPIC_COMPUTER_UPDATED: kafkaCons.ConsumeUpdateComputer(opts.Cfg, opts.ServiceComputer),
-		opts.Cfg.KAFKA_TOPIC_COMPUTER_DELETED: kafkaCons.ConsumeDeleteComputer(opts.Cfg, opts.ServiceComputer),
-	}
-
-	for topic, handler := range consumers {
-		consumer := kafkaCons.NewKafkaConsumer([]string{opts.Cfg.KAFKA_ADDRESS}, topic)
-		go func(t string, h func([]byte)) {
-			log.Printf("Starting consumer for topic: %s", t)
-			consumer.Consume(h)
-		}(topic, handler)
-	}
-
 	return &Handler{
-		cfg:                  opts.Cfg,
-		logger:               opts.Logger,
-		repositoryPostgres:   opts.RepositoryPostgres,
-		repositoryMongo:      opts.RepositoryMongo,
-		serviceUser:          opts.ServiceUser,
-		serviceComputer:      opts.ServiceComputer,
-		kafkaProducer:        kafkaProd.NewKafkaProducer([]string{opts.Cfg.KAFKA_ADDRESS}),
-		rabbitProducer:       opts.RabbitmqProducer,
-		rabbitConsumer:       opts.RabbitmqConsumer,
-		topicUserCreated:     opts.Cfg.KAFKA_TOPIC_USER_CREATED,
-		topicUserUpdated:     opts.Cfg.KAFKA_TOPIC_USER_UPDATED,
-		topicUserDeleted:     opts.Cfg.KAFKA_TOPIC_USER_DELETED,
-		topicComputerCreated: opts.Cfg.KAFKA_TOPIC_COMPUTER_CREATED,
-		topicComputerUpdated: opts.Cfg.KAFKA_TOPIC_COMPUTER_UPDATED,
-		topicComputerDeleted: opts.Cfg.KAFKA_TOPIC_COMPUTER_DELETED,
-		queueUserCreated:     opts.Cfg.RabbitMQ_QUEUE_USER_CREATED,
-		queueUserUpdated:     opts.Cfg.RabbitMQ_QUEUE_USER_UPDATED,
-		queueUserDeleted:     opts.Cfg.RabbitMQ_QUEUE_USER_DELETED,
-		queueComputerCreated: opts.Cfg.RabbitMQ_QUEUE_COMPUTER_CREATED,
-		queueComputerUpdated: opts.Cfg.RabbitMQ_QUEUE_COMPUTER_UPDATED,
-		queueComputerDeleted: opts.Cfg.RabbitMQ_QUEUE_COMPUTER_DELETED,
+		cfg:                opts.Cfg,
+		logger:             opts.Logger,
+		repositoryPostgres: opts.RepositoryPostgres,
+		repositoryMongo:    opts.RepositoryMongo,
+		serviceUser:        opts.ServiceUser,
+		serviceComputer:    opts.ServiceComputer,
+		userCommands:       opts.UserCommands,
+		computerCommands:   opts.ComputerCommands,
+		pipeline:           opts.Pipeline,
+		buses:              opts.Buses,
 	}
 }
 
+// accepted answers an async request with the pending command and where to
+// poll for its outcome.
+func accepted(response *responder.Response, cmd *command.Command) {
+	response.Code = http.StatusAccepted
+	response.Payload = cmd
+	response.ContentType = "application/json"
+	response.Headers = http.Header{"Location": {"/commands/" + cmd.ID}}
+}
+
+// UserReq and ComputerReq carry the same validate rules as the entities
+// they map to, so bad input is rejected before anything is published.
 type UserReq struct {
-	Name  string `json:"name"`
-	Age   int    `json:"age"`
-	Email string `json:"email"`
+	Name  string `json:"name" validate:"required,max=50"`
+	Age   int    `json:"age" validate:"required,min=1,max=150"`
+	Email string `json:"email" validate:"required,email,max=100"`
 }
 
 type ComputerReq struct {
-	IP           string `json:"ip"`
-	Manufacturer string `json:"manufacturer"`
-	CPU          string `json:"cpu" bson:"cpu"`
-	RAM          string `json:"ram" bson:"ram"`
-	HDD          string `json:"hdd" bson:"hdd"`
-	GPU          string `json:"gpu" bson:"gpu"`
-	OS           string `json:"os" bson:"os"`
+	IP           string `json:"ip" validate:"required,ip"`
+	Manufacturer string `json:"manufacturer" validate:"required"`
+	CPU          string `json:"cpu" bson:"cpu" validate:"required"`
+	RAM          string `json:"ram" bson:"ram" validate:"required"`
+	HDD          string `json:"hdd" bson:"hdd" validate:"required"`
+	GPU          string `json:"gpu" bson:"gpu" validate:"required"`
+	OS           string `json:"os" bson:"os" validate:"required,oneof=Windows Linux macOS FreeBSD ChromeOS"`
+	// OwnerID is the user owning the computer, none if empty.
+	OwnerID string `json:"ownerId" validate:"uuid"`
+}
+
+// OwnerReq assigns a computer to the user OwnerID, or unassigns it if
+// OwnerID is empty.
+type OwnerReq struct {
+	OwnerID string `json:"ownerId" validate:"uuid"`
 }
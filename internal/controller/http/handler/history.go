@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"practice/internal/controller/http/responder"
+	"practice/internal/pkg/audit"
+	"strconv"
+)
+
+// historyParams reads the page of a history request from its query, or
+// answers with 400 and returns false.
+func (h *Handler) historyParams(response *responder.Response, r *http.Request) (*audit.ListParams, bool) {
+	query := r.URL.Query()
+
+	params := &audit.ListParams{Cursor: query.Get("cursor")}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			h.logger.Error(fmt.Sprintf("bad request: %v", err))
+			responder.BadRequest(response, err)
+			return nil, false
+		}
+		params.Limit = n
+	}
+
+	return params, true
+}
@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"practice/internal/controller/http/responder"
+	"practice/internal/pkg/errs"
+	"slices"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+// Media types of PATCH bodies. Plain JSON is taken as a merge patch.
+const (
+	ContentTypeMergePatch = "application/merge-patch+json"
+	ContentTypeJSONPatch  = "application/json-patch+json"
+)
+
+// patch is a PATCH body: an RFC 7396 merge patch or an RFC 6902 JSON Patch.
+type patch struct {
+	isJSONPatch bool
+	jsonPatch   jsonpatch.Patch
+	merge       []byte
+	// fields are the top-level fields the patch writes, in order.
+	fields []string
+}
+
+var pointerEscaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// readPatch decodes the body of r by its Content-Type. Unsupported media
+// types are answered with 415 and malformed patches with 400, in which
+// case ok is false.
+func readPatch(response *responder.Response, r *http.Request) (p *patch, ok bool) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != ContentTypeMergePatch && mediaType != ContentTypeJSONPatch && mediaType != "application/json") {
+		responder.UnsupportedMediaType(response, ContentTypeMergePatch+", "+ContentTypeJSONPatch)
+		return nil, false
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		responder.WrongBodyFormat(response, err)
+		return nil, false
+	}
+
+	// fields stay non-nil, so an empty patch encodes as an empty list.
+	p = &patch{fields: []string{}}
+	if mediaType == ContentTypeJSONPatch {
+		err = p.decodeJSONPatch(body)
+	} else {
+		err = p.decodeMerge(body)
+	}
+	if err != nil {
+		responder.WrongBodyFormat(response, err)
+		return nil, false
+	}
+
+	return p, true
+}
+
+func (p *patch) decodeMerge(body []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+
+	// Walk the top-level keys in order; a patch that is not an object
+	// would replace the whole document, which no entity allows.
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('{') {
+		return errs.Validation("merge patch must be an object")
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		p.addField(tok.(string))
+
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return err
+		}
+	}
+
+	p.merge = body
+	return nil
+}
+
+func (p *patch) decodeJSONPatch(body []byte) error {
+	ops, err := jsonpatch.DecodePatch(body)
+	if err != nil {
+		return err
+	}
+
+	for _, op := range ops {
+		if op.Kind() == "test" {
+			continue
+		}
+
+		path, err := op.Path()
+		if err != nil {
+			return err
+		}
+		if err := p.addPointer(path); err != nil {
+			return err
+		}
+
+		// A move also removes its source.
+		if op.Kind() == "move" {
+			from, err := op.From()
+			if err != nil {
+				return err
+			}
+			if err := p.addPointer(from); err != nil {
+				return err
+			}
+		}
+	}
+
+	p.isJSONPatch, p.jsonPatch = true, ops
+	return nil
+}
+
+// addPointer records the top-level field a JSON pointer lies in.
+func (p *patch) addPointer(pointer string) error {
+	field, _, _ := strings.Cut(strings.TrimPrefix(pointer, "/"), "/")
+	if !strings.HasPrefix(pointer, "/") || field == "" {
+		return errs.Validation("patch must address fields, not " + pointer)
+	}
+
+	p.addField(pointerEscaper.Replace(field))
+	return nil
+}
+
+func (p *patch) addField(field string) {
+	if !slices.Contains(p.fields, field) {
+		p.fields = append(p.fields, field)
+	}
+}
+
+// apply patches the JSON form of doc and decodes the result into dst,
+// rejecting fields dst does not have. Patches that cannot be applied to
+// doc, such as a failing test operation, are conflicts.
+func (p *patch) apply(doc, dst any) error {
+	original, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	var patched []byte
+	if p.isJSONPatch {
+		patched, err = p.jsonPatch.Apply(original)
+	} else {
+		patched, err = jsonpatch.MergePatch(original, p.merge)
+	}
+	if err != nil {
+		return errs.Wrap(errs.KindConflict, err, "patch cannot be applied")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return errs.Wrap(errs.KindValidation, err, "invalid patch")
+	}
+
+	return nil
+}
+
+// version is the version a patched write has to find: the one named by
+// If-Match if any. Otherwise a JSON Patch, whose operations may depend on
+// the whole document, expects the version it was applied to, while a merge
+// patch only replaces the fields it names and may apply to any version.
+func (p *patch) version(ifMatch, applied int) int {
+	if ifMatch != 0 || !p.isJSONPatch {
+		return ifMatch
+	}
+	return applied
+}
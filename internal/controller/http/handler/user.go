@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"net/http"
 	"practice/internal/controller/http/responder"
+	"practice/internal/pkg/validator"
 	"practice/internal/repository/postgres/user"
+	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi"
 	"github.com/google/uuid"
@@ -21,8 +24,9 @@ import (
 // @Produce			json
 // @Param userData body UserReq true "User object"
 // @Success 201 {object} user.User
-// @Failure 400 {object} responder.Response
-// @Failure 500 {object} responder.Response
+// @Failure 400 {object} responder.Problem
+// @Failure 409 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
 func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithCancel(r.Context())
 	defer cancel()
@@ -32,7 +36,7 @@ func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		response = &responder.Response{}
 	)
 
-	defer responder.Send(w, response)
+	defer responder.Send(w, r, response)
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.logger.Error(fmt.Sprintf("wrong body format: %v", err))
@@ -40,6 +44,12 @@ func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := validator.Struct(req); err != nil {
+		h.logger.Error(fmt.Sprintf("invalid request: %v", err))
+		responder.Error(response, err)
+		return
+	}
+
 	res, err := h.serviceUser.Create(ctx, &user.User{
 		ID:        uuid.NewString(),
 		Name:      req.Name,
@@ -48,8 +58,8 @@ func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		IsDeleted: false,
 	})
 	if err != nil {
-		h.logger.Error(fmt.Sprintf("internal server error: %v", err))
-		responder.InternalServerError(response, err)
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(response, err)
 		return
 	}
 
@@ -65,25 +75,28 @@ func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
 // @Router /user/{id} [get]
 // @Param id path string true "User ID"
 // @Success 200 {object} user.User
-// @Failure 400 {object} responder.Response
-// @Failure 404 {object} responder.Response
-// @Failure 500 {object} responder.Response
+// @Header 200 {string} ETag "Version of the user"
+// @Failure 400 {object} responder.Problem
+// @Failure 404 {object} responder.Problem
+// @Failure 410 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
 func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithCancel(r.Context())
 	defer cancel()
 
 	var response responder.Response
-	defer responder.Send(w, &response)
+	defer responder.Send(w, r, &response)
 
 	id := chi.URLParam(r, "id")
 
 	res, err := h.serviceUser.Read(ctx, id)
 	if err != nil {
-		h.logger.Error(fmt.Sprintf("internal server error: %v", err))
-		responder.InternalServerError(&responder.Response{}, err)
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(&response, err)
 		return
 	}
 
+	withETag(&response, res.Version)
 	response.Code = http.StatusOK
 	response.Payload = res
 	response.ContentType = "application/json"
@@ -91,16 +104,23 @@ func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
 
 // UpdateUser godoc
 // @Summary User update
-// @Description Updates a user instance
+// @Description Updates a user instance if it is still at the version named by If-Match
 // @Tags User
 // @Router /user/{id} [put]
 // @Accept			json
 // @Produce			json
 // @Param id path string true "User ID"
+// @Param If-Match header string true "ETag of the user, or * to overwrite any version"
 // @Param userData body UserReq true "User object"
 // @Success 200 {object} user.User
-// @Failure 400 {object} responder.Response
-// @Failure 500 {object} responder.Response
+// @Header 200 {string} ETag "New version of the user"
+// @Failure 400 {object} responder.Problem
+// @Failure 404 {object} responder.Problem
+// @Failure 409 {object} responder.Problem
+// @Failure 410 {object} responder.Problem
+// @Failure 412 {object} responder.Problem
+// @Failure 428 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
 func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithCancel(r.Context())
 	defer cancel()
@@ -110,55 +130,168 @@ func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		response = &responder.Response{}
 	)
 
-	defer responder.Send(w, response)
+	defer responder.Send(w, r, response)
 
 	id := chi.URLParam(r, "id")
 
+	version, ok := ifMatch(response, r)
+	if !ok {
+		h.logger.Error("missing or invalid If-Match")
+		return
+	}
+
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.logger.Error(fmt.Sprintf("wrong body format: %v", err))
 		responder.WrongBodyFormat(response, err)
 		return
 	}
 
-	res, err := h.serviceUser.Update(ctx, &user.User{
-		ID:    id,
-		Name:  req.Name,
-		Age:   req.Age,
-		Email: req.Email,
-	})
+	if err := validator.Struct(req); err != nil {
+		h.logger.Error(fmt.Sprintf("invalid request: %v", err))
+		responder.Error(response, err)
+		return
+	}
+
+	u := &user.User{
+		ID:      id,
+		Name:    req.Name,
+		Age:     req.Age,
+		Email:   req.Email,
+		Version: version,
+	}
+
+	res, err := h.serviceUser.Update(ctx, u)
 	if err != nil {
-		h.logger.Error(fmt.Sprintf("internal server error: %v", err))
-		responder.InternalServerError(response, err)
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(response, err)
 		return
 	}
 
+	withETag(response, u.Version)
 	response.Code = http.StatusOK
 	response.Payload = res
 	response.ContentType = "application/json"
 }
 
+// PatchUser godoc
+// @Summary User partial update
+// @Description Updates the given fields of a user instance with a JSON merge patch or a JSON Patch.
+// @Description Without If-Match, merge patches apply to any version and JSON Patches to the version they were applied to.
+// @Tags User
+// @Router /user/{id} [patch]
+// @Accept			application/merge-patch+json,application/json-patch+json
+// @Produce			json
+// @Param id path string true "User ID"
+// @Param If-Match header string false "ETag of the user"
+// @Param patch body UserReq true "Merge patch, or a JSON Patch array"
+// @Success 200 {object} user.User
+// @Header 200 {string} ETag "New version of the user"
+// @Failure 400 {object} responder.Problem
+// @Failure 404 {object} responder.Problem
+// @Failure 409 {object} responder.Problem
+// @Failure 410 {object} responder.Problem
+// @Failure 412 {object} responder.Problem
+// @Failure 415 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
+func (h *Handler) PatchUser(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	response := &responder.Response{}
+	defer responder.Send(w, r, response)
+
+	patch, ok := h.userPatch(ctx, response, r)
+	if !ok {
+		return
+	}
+
+	if _, err := h.serviceUser.Patch(ctx, patch); err != nil {
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(response, err)
+		return
+	}
+
+	withETag(response, patch.Version)
+	response.Code = http.StatusOK
+	response.Payload = &patch.User
+	response.ContentType = "application/json"
+}
+
+// userPatch applies the PATCH body of r to the current user and returns the
+// validated result, or fills response and returns false.
+func (h *Handler) userPatch(ctx context.Context, response *responder.Response, r *http.Request) (*user.Patch, bool) {
+	id := chi.URLParam(r, "id")
+
+	version, ok := ifMatchOptional(response, r)
+	if !ok {
+		h.logger.Error("invalid If-Match")
+		return nil, false
+	}
+
+	p, ok := readPatch(response, r)
+	if !ok {
+		h.logger.Error("unsupported or malformed patch")
+		return nil, false
+	}
+
+	current, err := h.serviceUser.Read(ctx, id)
+	if err == nil {
+		err = checkVersion("user", version, current.Version)
+	}
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(response, err)
+		return nil, false
+	}
+
+	var req UserReq
+	err = p.apply(UserReq{Name: current.Name, Age: current.Age, Email: current.Email}, &req)
+	if err == nil {
+		err = validator.Struct(req)
+	}
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("invalid request: %v", err))
+		responder.Error(response, err)
+		return nil, false
+	}
+
+	return &user.Patch{
+		User: user.User{
+			ID:      id,
+			Name:    req.Name,
+			Age:     req.Age,
+			Email:   req.Email,
+			Version: p.version(version, current.Version),
+		},
+		Fields: p.fields,
+	}, true
+}
+
 // DeleteUser godoc
 // @Summary User deletion
-// @Description Deletes a user instance
+// @Description Deletes a user instance. Its computers are given to the user reassignTo, or unassigned, shortly after.
 // @Tags User
 // @Router /user/{id} [delete]
 // @Param id path string true "User ID"
+// @Param reassignTo query string false "User to give the computers of the deleted user to; they are unassigned otherwise"
 // @Success 200 {object} user.User
-// @Failure 400 {object} responder.Response
-// @Failure 500 {object} responder.Response
+// @Failure 400 {object} responder.Problem "Malformed request, or reassignTo does not exist or is deleted"
+// @Failure 404 {object} responder.Problem
+// @Failure 410 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
 func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithCancel(r.Context())
 	defer cancel()
 
 	var response responder.Response
-	defer responder.Send(w, &response)
+	defer responder.Send(w, r, &response)
 
 	id := chi.URLParam(r, "id")
 
-	id, err := h.serviceUser.Delete(ctx, id)
+	id, err := h.serviceUser.Delete(ctx, id, r.URL.Query().Get("reassignTo"))
 	if err != nil {
-		h.logger.Error(fmt.Sprintf("internal server error: %v", err))
-		responder.InternalServerError(&responder.Response{}, err)
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(&response, err)
 		return
 	}
 
@@ -166,3 +299,221 @@ func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	response.Payload = id
 	response.ContentType = "application/json"
 }
+
+// RestoreUser godoc
+// @Summary User restoring
+// @Description Undoes the deletion of a user
+// @Tags User
+// @Router /user/{id}/restore [post]
+// @Param id path string true "User ID"
+// @Success 200 {object} user.User
+// @Header 200 {string} ETag "New version of the user"
+// @Failure 400 {object} responder.Problem
+// @Failure 404 {object} responder.Problem
+// @Failure 409 {object} responder.Problem "The user is not deleted, or its email is taken"
+// @Failure 500 {object} responder.Problem
+func (h *Handler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	var response responder.Response
+	defer responder.Send(w, r, &response)
+
+	res, err := h.serviceUser.Restore(ctx, chi.URLParam(r, "id"))
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(&response, err)
+		return
+	}
+
+	withETag(&response, res.Version)
+	response.Code = http.StatusOK
+	response.Payload = res
+	response.ContentType = "application/json"
+}
+
+// PurgeUser godoc
+// @Summary User purging
+// @Description Removes a user for good, whether deleted or not
+// @Tags Admin
+// @Router /admin/user/{id} [delete]
+// @Param id path string true "User ID"
+// @Success 204
+// @Failure 400 {object} responder.Problem
+// @Failure 404 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
+func (h *Handler) PurgeUser(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	var response responder.Response
+	defer responder.Send(w, r, &response)
+
+	if err := h.serviceUser.Purge(ctx, chi.URLParam(r, "id")); err != nil {
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(&response, err)
+		return
+	}
+
+	response.Code = http.StatusNoContent
+}
+
+// GetUserComputers godoc
+// @Summary User computers
+// @Description Returns a page of the computers assigned to a user
+// @Tags User
+// @Router /user/{id}/computers [get]
+// @Param id path string true "User ID"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param cursor query string false "Next page token from a previous response"
+// @Param sort query string false "Sort field: id, ip, manufacturer, cpu or os; prefix with - for descending"
+// @Success 200 {object} computer.Page
+// @Failure 400 {object} responder.Problem
+// @Failure 404 {object} responder.Problem
+// @Failure 410 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
+func (h *Handler) GetUserComputers(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	var response responder.Response
+	defer responder.Send(w, r, &response)
+
+	params, ok := h.computerListParams(&response, r)
+	if !ok {
+		return
+	}
+
+	owner, err := h.serviceUser.Read(ctx, chi.URLParam(r, "id"))
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(&response, err)
+		return
+	}
+	params.OwnerID = owner.ID
+
+	res, err := h.serviceComputer.List(ctx, params)
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(&response, err)
+		return
+	}
+
+	response.Code = http.StatusOK
+	response.Payload = res
+	response.ContentType = "application/json"
+}
+
+// GetUserHistory godoc
+// @Summary User history
+// @Description Returns a page of the changes to a user, newest first, with the user before and after each change, who made it and through what.
+// @Description The history of purged users is kept.
+// @Tags User
+// @Router /user/{id}/history [get]
+// @Param id path string true "User ID"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param cursor query string false "Next page token from a previous response"
+// @Success 200 {object} audit.Page
+// @Failure 400 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
+func (h *Handler) GetUserHistory(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	var response responder.Response
+	defer responder.Send(w, r, &response)
+
+	params, ok := h.historyParams(&response, r)
+	if !ok {
+		return
+	}
+
+	res, err := h.serviceUser.History(ctx, chi.URLParam(r, "id"), params)
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(&response, err)
+		return
+	}
+
+	response.Code = http.StatusOK
+	response.Payload = res
+	response.ContentType = "application/json"
+}
+
+// ListUsers godoc
+// @Summary User list
+// @Description Returns a page of user instances with the total number of matches
+// @Tags User
+// @Router /user [get]
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param cursor query string false "Next page token from a previous response"
+// @Param sort query string false "Sort field: id, name, age or email; prefix with - for descending"
+// @Param name query string false "Name substring"
+// @Param email query string false "Email substring"
+// @Param minAge query int false "Minimum age"
+// @Param maxAge query int false "Maximum age"
+// @Param includeDeleted query bool false "Include soft-deleted users"
+// @Success 200 {object} user.Page
+// @Failure 400 {object} responder.Problem
+// @Failure 500 {object} responder.Problem
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	var response responder.Response
+	defer responder.Send(w, r, &response)
+
+	query := r.URL.Query()
+
+	params := &user.ListParams{
+		Cursor: query.Get("cursor"),
+		Name:   query.Get("name"),
+		Email:  query.Get("email"),
+	}
+
+	ints := map[string]*int{
+		"limit":  &params.Limit,
+		"minAge": &params.MinAge,
+		"maxAge": &params.MaxAge,
+	}
+	for key, dst := range ints {
+		val := query.Get(key)
+		if val == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			h.logger.Error(fmt.Sprintf("bad request: %v", err))
+			responder.BadRequest(&response, err)
+			return
+		}
+		*dst = n
+	}
+
+	if val := query.Get("includeDeleted"); val != "" {
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			h.logger.Error(fmt.Sprintf("bad request: %v", err))
+			responder.BadRequest(&response, err)
+			return
+		}
+		params.IncludeDeleted = b
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		params.SortBy = strings.TrimPrefix(sort, "-")
+		params.SortDesc = strings.HasPrefix(sort, "-")
+	}
+
+	res, err := h.serviceUser.List(ctx, params)
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("request failed: %v", err))
+		responder.Error(&response, err)
+		return
+	}
+
+	response.Code = http.StatusOK
+	response.Payload = res
+	response.ContentType = "application/json"
+}
@@ -2,39 +2,123 @@ package responder
 
 import (
 	"encoding/json"
-	"errors"
 	"net/http"
+	"practice/internal/pkg/errs"
 )
 
+const ProblemContentType = "application/problem+json"
+
 type Response struct {
 	Code        int
 	Payload     any
 	ContentType string
+	Headers     http.Header
 }
 
-func Send(w http.ResponseWriter, response *Response) {
-	if response.Payload == nil && response.Code != http.StatusNoContent {
-		w.WriteHeader(http.StatusInternalServerError)
-		_, _ = w.Write([]byte("response payload is null"))
+// Problem is an RFC 7807 problem details document. Errors is only set for
+// validation failures and lists the rejected fields.
+type Problem struct {
+	Type     string            `json:"type"`
+	Title    string            `json:"title"`
+	Status   int               `json:"status"`
+	Detail   string            `json:"detail,omitempty"`
+	Instance string            `json:"instance,omitempty"`
+	Errors   []errs.FieldError `json:"errors,omitempty"`
+}
+
+// Send writes response to w. Problem payloads without an instance get the
+// request path.
+func Send(w http.ResponseWriter, r *http.Request, response *Response) {
+	if response.Code == http.StatusNotModified {
+		w.WriteHeader(response.Code)
 		return
 	}
 
+	if response.Payload == nil && response.Code != http.StatusNoContent {
+		InternalServerError(response)
+	}
+
+	if problem, ok := response.Payload.(*Problem); ok && problem.Instance == "" {
+		problem.Instance = r.URL.Path
+	}
+
+	for key, values := range response.Headers {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+
 	w.Header().Set("Content-Type", response.ContentType)
 	w.WriteHeader(response.Code)
 	_ = json.NewEncoder(w).Encode(response.Payload)
 }
 
 func WrongBodyFormat(response *Response, err error) {
-	response.Code = http.StatusBadRequest
-	response.Payload = errors.New("wrong body format: " + err.Error())
+	problem(response, http.StatusBadRequest, "/problems/wrong-body-format", "wrong body format: "+err.Error())
+}
+
+func BadRequest(response *Response, err error) {
+	problem(response, http.StatusBadRequest, "/problems/bad-request", err.Error())
 }
 
 func NotFound(response *Response) {
-	response.Code = http.StatusNotFound
-	response.Payload = errors.New("not found")
+	problem(response, http.StatusNotFound, "/problems/not-found", "")
 }
 
-func InternalServerError(response *Response, err error) {
-	response.Code = http.StatusInternalServerError
-	response.Payload = errors.New("internal server error: " + err.Error())
+// InternalServerError hides the cause, which may name internals of the
+// stores and brokers; callers log it.
+func InternalServerError(response *Response) {
+	problem(response, http.StatusInternalServerError, "about:blank", "internal server error")
+}
+
+// PreconditionRequired rejects a conditional write sent without If-Match.
+func PreconditionRequired(response *Response) {
+	problem(response, http.StatusPreconditionRequired, "/problems/precondition-required", "the If-Match header is required")
+}
+
+// UnsupportedMediaType rejects a body whose Content-Type is not one of
+// accepted.
+func UnsupportedMediaType(response *Response, accepted string) {
+	problem(response, http.StatusUnsupportedMediaType, "/problems/unsupported-media-type", "the body must be one of "+accepted)
+}
+
+func Unavailable(response *Response, err error) {
+	problem(response, http.StatusServiceUnavailable, "/problems/unavailable", err.Error())
+}
+
+// Error fills response according to the errs kind of err, falling back to
+// InternalServerError for unclassified errors. Only the message of the
+// classified error is sent, not the errors it wraps.
+func Error(response *Response, err error) {
+	detail := errs.MessageOf(err)
+
+	switch errs.KindOf(err) {
+	case errs.KindNotFound:
+		problem(response, http.StatusNotFound, "/problems/not-found", detail)
+	case errs.KindValidation:
+		problem(response, http.StatusBadRequest, "/problems/validation", detail)
+		response.Payload.(*Problem).Errors = errs.FieldsOf(err)
+	case errs.KindConflict:
+		problem(response, http.StatusConflict, "/problems/conflict", detail)
+	case errs.KindAlreadyDeleted:
+		problem(response, http.StatusGone, "/problems/already-deleted", detail)
+	case errs.KindPreconditionFailed:
+		problem(response, http.StatusPreconditionFailed, "/problems/precondition-failed", detail)
+	case errs.KindNotModified:
+		response.Code = http.StatusNotModified
+		response.Payload = nil
+	default:
+		InternalServerError(response)
+	}
+}
+
+func problem(response *Response, status int, typ, detail string) {
+	response.Code = status
+	response.ContentType = ProblemContentType
+	response.Payload = &Problem{
+		Type:   typ,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
 }
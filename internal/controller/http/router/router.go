@@ -3,13 +3,19 @@ package router
 import (
 	"context"
 	"log/slog"
+	"net"
 	"net/http"
 	"practice/internal/controller/http/handler"
+	"practice/internal/pkg/audit"
+	"practice/internal/pkg/bus"
 	"practice/internal/pkg/config"
 
 	swagger "github.com/swaggo/http-swagger/v2"
 
 	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/fx"
 )
 
@@ -19,6 +25,10 @@ type Options struct {
 	Config  *config.Config
 	Logger  *slog.Logger
 	Handler *handler.Handler
+	// Buses are the transports that could be set up. Async routes are only
+	// mounted for them, as commands sent to others could never be delivered.
+	Buses      *bus.Registry
+	Shutdowner fx.Shutdowner
 }
 
 var Module = fx.Options(
@@ -27,38 +37,60 @@ var Module = fx.Options(
 
 func New(opts Options) {
 	router := chi.NewRouter()
+	router.Use(middleware.RequestID, correlate, identify)
 
 	router.Mount("/docs", swagger.WrapHandler)
+	router.Handle("/metrics", promhttp.Handler())
 
 	router.Route("/user", func(r chi.Router) {
+		r.Get("/", opts.Handler.ListUsers)
 		r.Get("/{id}", opts.Handler.GetUser)
 		r.Post("/", opts.Handler.CreateUser)
 		r.Put("/{id}", opts.Handler.UpdateUser)
+		r.Patch("/{id}", opts.Handler.PatchUser)
 		r.Delete("/{id}", opts.Handler.DeleteUser)
-		// Kafka
-		r.Post("/kafka", opts.Handler.CreateUserKafka)
-		r.Put("/kafka/{id}", opts.Handler.UpdateUserKafka)
-		r.Delete("/kafka/{id}", opts.Handler.DeleteUserKafka)
-		// RabbitMQ
-		r.Post("/rabbit", opts.Handler.CreateUserRabbit)
-		r.Put("/rabbit/{id}", opts.Handler.UpdateUserRabbit)
-		r.Delete("/rabbit/{id}", opts.Handler.DeleteUserRabbit)
+		r.Post("/{id}/restore", opts.Handler.RestoreUser)
+		r.Get("/{id}/history", opts.Handler.GetUserHistory)
+		r.Get("/{id}/computers", opts.Handler.GetUserComputers)
+		// Message buses
+		for _, transport := range opts.Buses.Names() {
+			path := "/" + handler.BusPath(transport)
+			r.Post(path, opts.Handler.CreateUserAsync(transport))
+			r.Put(path+"/{id}", opts.Handler.UpdateUserAsync(transport))
+			r.Patch(path+"/{id}", opts.Handler.PatchUserAsync(transport))
+			r.Delete(path+"/{id}", opts.Handler.DeleteUserAsync(transport))
+		}
 	})
 
 	router.Route("/computer", func(r chi.Router) {
 		r.Get("/{id}", opts.Handler.GetComputer)
 		r.Post("/", opts.Handler.CreateComputer)
 		r.Put("/{id}", opts.Handler.UpdateComputer)
+		r.Patch("/{id}", opts.Handler.PatchComputer)
 		r.Delete("/{id}", opts.Handler.DeleteComputer)
+		r.Post("/{id}/restore", opts.Handler.RestoreComputer)
+		r.Get("/{id}/history", opts.Handler.GetComputerHistory)
+		r.Put("/{id}/owner", opts.Handler.AssignComputer)
 		r.Get("/", opts.Handler.ListComputers)
-		// Kafka
-		r.Post("/kafka", opts.Handler.CreateComputerKafka)
-		r.Put("/kafka/{id}", opts.Handler.UpdateComputerKafka)
-		r.Delete("/kafka/{id}", opts.Handler.DeleteComputerKafka)
-		// RabbitMQ
-		r.Post("/rabbit", opts.Handler.CreateComputerRabbit)
-		r.Put("/rabbit/{id}", opts.Handler.UpdateComputerRabbit)
-		r.Delete("/rabbit/{id}", opts.Handler.DeleteComputerRabbit)
+		// Message buses
+		for _, transport := range opts.Buses.Names() {
+			path := "/" + handler.BusPath(transport)
+			r.Post(path, opts.Handler.CreateComputerAsync(transport))
+			r.Put(path+"/{id}", opts.Handler.UpdateComputerAsync(transport))
+			r.Patch(path+"/{id}", opts.Handler.PatchComputerAsync(transport))
+			r.Delete(path+"/{id}", opts.Handler.DeleteComputerAsync(transport))
+		}
+	})
+
+	router.Get("/commands/{id}", opts.Handler.GetCommand)
+
+	router.Delete("/admin/user/{id}", opts.Handler.PurgeUser)
+	router.Delete("/admin/computer/{id}", opts.Handler.PurgeComputer)
+
+	router.Route("/admin/dlq", func(r chi.Router) {
+		r.Get("/", opts.Handler.ListDeadLetterQueues)
+		r.Get("/{queue}", opts.Handler.GetDeadLetters)
+		r.Post("/{queue}/replay", opts.Handler.ReplayDeadLetters)
 	})
 
 	server := http.Server{
@@ -69,17 +101,27 @@ func New(opts Options) {
 	}
 
 	opts.Lifecycle.Append(fx.Hook{
-		OnStart: onStart(&server, opts.Config, opts.Logger),
+		OnStart: onStart(&server, opts.Config, opts.Logger, opts.Shutdowner),
 		OnStop:  onStop(&server, opts.Logger),
 	})
 }
 
-func onStart(srv *http.Server, cfg *config.Config, log *slog.Logger) func(_ context.Context) error {
+// onStart listens before returning, so a taken address fails startup. If
+// the server stops serving on its own, the application is shut down so the
+// other modules still stop gracefully.
+func onStart(srv *http.Server, cfg *config.Config, log *slog.Logger, shutdowner fx.Shutdowner) func(_ context.Context) error {
 	return func(_ context.Context) error {
-		log.Info("starting server on %s", cfg.ADDRESS)
+		log.Info("starting server", "address", cfg.ADDRESS)
+		ln, err := net.Listen("tcp", srv.Addr)
+		if err != nil {
+			return errors.Wrap(err, "failed to start server")
+		}
 		go func() {
-			if err := srv.ListenAndServe(); err != nil {
-				panic("failed to start server: " + err.Error())
+			if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error("server failed", "error", err.Error())
+				if err := shutdowner.Shutdown(fx.ExitCode(1)); err != nil {
+					log.Error("error while shutting down", "error", err.Error())
+				}
 			}
 		}()
 		return nil
@@ -90,8 +132,33 @@ func onStop(srv *http.Server, log *slog.Logger) func(_ context.Context) error {
 	return func(ctx context.Context) error {
 		log.Info("shutdown server by signal")
 		if err := srv.Shutdown(ctx); err != nil {
-			log.Error("server forced to shutdown: %v", err)
+			log.Error("server forced to shutdown", "error", err)
 		}
 		return nil
 	}
 }
+
+// correlate makes the request id, taken from X-Request-Id when the client
+// sends one, the correlation id of the messages the request causes, and
+// echoes it in the response.
+func correlate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := middleware.GetReqID(r.Context())
+		w.Header().Set(middleware.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(bus.WithCorrelationID(r.Context(), id)))
+	})
+}
+
+// ActorHeader names the caller on whose behalf a request is made. The
+// service has no authentication, so it is trusted as sent.
+const ActorHeader = "X-Actor"
+
+// identify makes the caller named by ActorHeader the actor of the changes
+// the request causes, directly or through messages, and HTTP the source of
+// those it makes directly.
+func identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := bus.WithActor(r.Context(), r.Header.Get(ActorHeader))
+		next.ServeHTTP(w, r.WithContext(audit.WithSource(ctx, audit.SourceHTTP)))
+	})
+}
@@ -2,40 +2,239 @@ package consumer
 
 import (
 	"context"
+	"practice/internal/pkg/bus"
+	"practice/internal/pkg/errs"
+	"practice/internal/pkg/metrics"
+	"practice/internal/pkg/outbox"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/segmentio/kafka-go"
 )
 
+// DeadLetterSuffix is appended to a topic to name its dead-letter topic.
+const DeadLetterSuffix = ".DLT"
+
 type IKafkaConsumer interface {
-	Consume(handler func(message []byte)) error
+	Consume(ctx context.Context, handler bus.Handler) error
 	Close()
 }
 
+type Config struct {
+	Brokers    []string
+	Topic      string
+	GroupID    string
+	MaxRetries int
+	Backoff    time.Duration
+	// Concurrency is the number of partition workers.
+	Concurrency int
+	// OnDeadLetter, if set, is called with the handler context once a
+	// message has been written to the dead-letter topic.
+	OnDeadLetter func(ctx context.Context, msg *bus.Message, cause error)
+}
+
 type KafkaConsumer struct {
-	reader *kafka.Reader
+	cfg        Config
+	reader     *kafka.Reader
+	deadLetter *kafka.Writer
 }
 
-func NewKafkaConsumer(broker []string, topic string) IKafkaConsumer {
+func NewKafkaConsumer(cfg Config) IKafkaConsumer {
 	return &KafkaConsumer{
+		cfg: cfg,
 		reader: kafka.NewReader(
 			kafka.ReaderConfig{
-				Brokers: broker,
-				Topic:   topic,
+				Brokers:     cfg.Brokers,
+				Topic:       cfg.Topic,
+				GroupID:     cfg.GroupID,
+				StartOffset: kafka.FirstOffset,
 			},
 		),
+		deadLetter: &kafka.Writer{
+			Addr:                   kafka.TCP(cfg.Brokers...),
+			Topic:                  cfg.Topic + DeadLetterSuffix,
+			AllowAutoTopicCreation: true,
+		},
+	}
+}
+
+// Consume hands every fetched message to the worker of its partition, so
+// up to Concurrency partitions are handled in parallel while the messages
+// of a partition are handled, and their offsets committed, in order. Each
+// offset is committed only after the handler succeeded or the message was
+// dead-lettered, so a crash leads to redelivery rather than loss.
+// Cancelling ctx stops fetching but lets the messages in flight finish and
+// be committed; it returns nil once that is done.
+func (k *KafkaConsumer) Consume(ctx context.Context, handler bus.Handler) error {
+	// In-flight work must outlive the stop signal, otherwise a shutdown
+	// would abort half-applied changes and leave them uncommitted.
+	drain := context.WithoutCancel(ctx)
+
+	// A failing worker stops the fetching, and with it the others.
+	fetchCtx, fail := context.WithCancelCause(ctx)
+	defer fail(nil)
+
+	var wg sync.WaitGroup
+	workers := make([]chan kafka.Message, max(k.cfg.Concurrency, 1))
+	for i := range workers {
+		workers[i] = make(chan kafka.Message)
+
+		wg.Add(1)
+		go func(messages <-chan kafka.Message) {
+			defer wg.Done()
+			for m := range messages {
+				if err := k.process(fetchCtx, drain, m, handler); err != nil && fetchCtx.Err() == nil {
+					fail(err)
+				}
+			}
+		}(workers[i])
+	}
+
+	err := k.fetch(fetchCtx, workers)
+
+	for _, w := range workers {
+		close(w)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return nil
 	}
+	if err != nil {
+		return err
+	}
+	return context.Cause(fetchCtx)
 }
 
-func (k *KafkaConsumer) Consume(handler func(message []byte)) error {
+func (k *KafkaConsumer) fetch(ctx context.Context, workers []chan kafka.Message) error {
+	lag := metrics.Lag.WithLabelValues(outbox.TransportKafka, k.cfg.Topic)
+	partitions := map[int]int64{}
+
 	for {
-		m, err := k.reader.ReadMessage(context.Background())
+		m, err := k.reader.FetchMessage(ctx)
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.Wrap(err, "error while fetching message")
+		}
+
+		partitions[m.Partition] = max(m.HighWaterMark-m.Offset-1, 0)
+		var total int64
+		for _, n := range partitions {
+			total += n
+		}
+		lag.Set(float64(total))
+
+		select {
+		case workers[m.Partition%len(workers)] <- m:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (k *KafkaConsumer) process(ctx, drain context.Context, m kafka.Message, handler bus.Handler) error {
+	if err := k.handle(ctx, drain, m, handler); err != nil {
+		return err
+	}
+
+	if err := k.reader.CommitMessages(drain, m); err != nil {
+		return errors.Wrap(err, "error while committing offset")
+	}
+	return nil
+}
+
+// handle runs handler with drain and waits between retries on ctx, so a
+// shutdown skips the remaining retries and leaves the message uncommitted.
+func (k *KafkaConsumer) handle(ctx, drain context.Context, m kafka.Message, handler bus.Handler) error {
+	var (
+		err     error
+		attempt int
+		msg     = messageOf(m)
+	)
+
+	for attempt = 1; ; attempt++ {
+		if err = handler(drain, msg); err == nil {
+			return nil
+		}
+
+		if !errs.Retryable(err) || attempt > k.cfg.MaxRetries {
+			break
+		}
+
+		if err := sleep(ctx, k.cfg.Backoff<<(attempt-1)); err != nil {
+			return err
+		}
+	}
+
+	if err := k.sendToDeadLetter(ctx, drain, m, attempt, err); err != nil {
+		return err
+	}
+
+	if k.cfg.OnDeadLetter != nil {
+		k.cfg.OnDeadLetter(drain, msg, err)
+	}
+	return nil
+}
+
+// sendToDeadLetter keeps trying until the message is written, since
+// committing the offset without it would lose the message.
+func (k *KafkaConsumer) sendToDeadLetter(ctx, drain context.Context, m kafka.Message, attempts int, cause error) error {
+	headers := append([]kafka.Header{}, m.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: "x-original-topic", Value: []byte(m.Topic)},
+		kafka.Header{Key: "x-original-partition", Value: []byte(strconv.Itoa(m.Partition))},
+		kafka.Header{Key: "x-original-offset", Value: []byte(strconv.FormatInt(m.Offset, 10))},
+		kafka.Header{Key: "x-attempts", Value: []byte(strconv.Itoa(attempts))},
+		kafka.Header{Key: "x-last-error", Value: []byte(cause.Error())},
+	)
+
+	for attempt := 0; ; attempt++ {
+		err := k.deadLetter.WriteMessages(drain, kafka.Message{
+			Key:     m.Key,
+			Value:   m.Value,
+			Headers: headers,
+		})
+		if err == nil {
+			return nil
+		}
+
+		if err := sleep(ctx, k.cfg.Backoff<<min(attempt, 6)); err != nil {
 			return err
 		}
-		handler(m.Value)
 	}
 }
 
 func (k *KafkaConsumer) Close() {
 	k.reader.Close()
+	k.deadLetter.Close()
+}
+
+func messageOf(m kafka.Message) *bus.Message {
+	headers := make(map[string]string, len(m.Headers))
+	for _, h := range m.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+
+	return &bus.Message{
+		Topic:   m.Topic,
+		Key:     string(m.Key),
+		Headers: headers,
+		Payload: m.Value,
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
 }
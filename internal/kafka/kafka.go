@@ -0,0 +1,70 @@
+package kafka
+
+import (
+	"context"
+	"practice/internal/kafka/consumer"
+	"practice/internal/kafka/producer"
+	"practice/internal/pkg/bus"
+	"practice/internal/pkg/config"
+	"practice/internal/pkg/outbox"
+	"slices"
+
+	"go.uber.org/fx"
+)
+
+var Module = fx.Options(
+	producer.Module,
+	fx.Provide(fx.Annotate(New, fx.ResultTags(`group:"buses"`))),
+)
+
+type Options struct {
+	fx.In
+	Cfg      *config.Config
+	Producer producer.IKafkaProducer
+}
+
+// Bus publishes through the shared producer and gives every subscription
+// its own consumer group member and dead-letter topic.
+type Bus struct {
+	cfg      *config.Config
+	producer producer.IKafkaProducer
+}
+
+func New(opts Options) bus.Bus {
+	if !slices.Contains(opts.Cfg.BUS_TRANSPORTS, outbox.TransportKafka) {
+		return nil
+	}
+
+	return &Bus{
+		cfg:      opts.Cfg,
+		producer: opts.Producer,
+	}
+}
+
+func (b *Bus) Name() string {
+	return outbox.TransportKafka
+}
+
+func (b *Bus) Publish(ctx context.Context, msg *bus.Message) error {
+	return b.producer.Produce(ctx, msg.Topic, msg.Key, msg.Payload, msg.Headers)
+}
+
+func (b *Bus) Subscribe(ctx context.Context, sub bus.Subscription) error {
+	concurrency, ok := b.cfg.KAFKA_TOPIC_CONCURRENCY[sub.Topic]
+	if !ok {
+		concurrency = b.cfg.KAFKA_CONCURRENCY
+	}
+
+	c := consumer.NewKafkaConsumer(consumer.Config{
+		Brokers:      []string{b.cfg.KAFKA_ADDRESS},
+		Topic:        sub.Topic,
+		GroupID:      b.cfg.KAFKA_GROUP_ID,
+		MaxRetries:   b.cfg.KAFKA_MAX_RETRIES,
+		Backoff:      b.cfg.KAFKA_RETRY_BACKOFF,
+		Concurrency:  concurrency,
+		OnDeadLetter: sub.OnDeadLetter,
+	})
+	defer c.Close()
+
+	return c.Consume(ctx, sub.Handler)
+}
@@ -2,32 +2,130 @@ package producer
 
 import (
 	"context"
+	"log/slog"
+	"practice/internal/pkg/config"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/segmentio/kafka-go"
+	"go.uber.org/fx"
 )
 
+var Module = fx.Provide(New)
+
+type Options struct {
+	fx.In
+	fx.Lifecycle
+	Cfg    *config.Config
+	Logger *slog.Logger
+}
+
 type IKafkaProducer interface {
-	Produce(ctx context.Context, topic string, msg []byte) error
+	Produce(ctx context.Context, topic, key string, msg []byte, headers map[string]string) error
 	Close()
 }
 
+type Config struct {
+	Brokers      []string
+	BatchSize    int
+	BatchTimeout time.Duration
+	// Compression is one of none, gzip, snappy, lz4 or zstd.
+	Compression string
+	// RequiredAcks is one of none, one or all.
+	RequiredAcks string
+	// Async makes Produce return before the write is acknowledged.
+	// Failures are then only reported to OnError.
+	Async   bool
+	OnError func(messages []kafka.Message, err error)
+}
+
 type KafkaProducer struct {
 	writer *kafka.Writer
 }
 
-func NewKafkaProducer(brokers []string) IKafkaProducer {
+// New provides the shared producer and closes it on stop, flushing any
+// buffered writes. Components that publish during shutdown must stop
+// before it, which fx guarantees for anything that depends on it.
+func New(opts Options) (IKafkaProducer, error) {
+	producer, err := NewKafkaProducer(Config{
+		Brokers:      []string{opts.Cfg.KAFKA_ADDRESS},
+		BatchSize:    opts.Cfg.KAFKA_BATCH_SIZE,
+		BatchTimeout: opts.Cfg.KAFKA_BATCH_TIMEOUT,
+		Compression:  opts.Cfg.KAFKA_COMPRESSION,
+		RequiredAcks: opts.Cfg.KAFKA_REQUIRED_ACKS,
+		Async:        opts.Cfg.KAFKA_ASYNC,
+		OnError: func(messages []kafka.Message, err error) {
+			for _, m := range messages {
+				opts.Logger.Error("failed to produce to kafka",
+					"topic", m.Topic, "key", string(m.Key), "error", err.Error())
+			}
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Lifecycle.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			producer.Close()
+			return nil
+		},
+	})
+
+	return producer, nil
+}
+
+// NewKafkaProducer spreads messages over partitions by a hash of their key,
+// so the messages of one entity stay in order; messages without a key are
+// spread round-robin.
+func NewKafkaProducer(cfg Config) (IKafkaProducer, error) {
 	w := &kafka.Writer{
-		Addr:                   kafka.TCP(brokers...),
+		Addr:                   kafka.TCP(cfg.Brokers...),
+		Balancer:               &kafka.Hash{},
+		BatchSize:              cfg.BatchSize,
+		BatchTimeout:           cfg.BatchTimeout,
+		Async:                  cfg.Async,
 		AllowAutoTopicCreation: true,
 	}
 
-	return &KafkaProducer{writer: w}
+	if err := w.Compression.UnmarshalText([]byte(cfg.Compression)); err != nil {
+		return nil, errors.Wrap(err, "invalid kafka compression")
+	}
+	if err := w.RequiredAcks.UnmarshalText([]byte(cfg.RequiredAcks)); err != nil {
+		return nil, errors.Wrap(err, "invalid kafka required acks")
+	}
+
+	if cfg.Async && cfg.OnError != nil {
+		w.Completion = func(messages []kafka.Message, err error) {
+			if err != nil {
+				cfg.OnError(messages, err)
+			}
+		}
+	}
+
+	return &KafkaProducer{writer: w}, nil
 }
 
-func (k *KafkaProducer) Produce(ctx context.Context, topic string, msg []byte) error {
+// Produce writes msg under key, the id of the entity it is about, with
+// headers. Unless the producer is async, it returns once the write is
+// acknowledged as configured by RequiredAcks.
+func (k *KafkaProducer) Produce(ctx context.Context, topic, key string, msg []byte, headers map[string]string) error {
+	var hs []kafka.Header
+	for key, value := range headers {
+		hs = append(hs, kafka.Header{Key: key, Value: []byte(value)})
+	}
+
+	// A nil key, unlike an empty one, leaves partitioning to the balancer.
+	var msgKey []byte
+	if key != "" {
+		msgKey = []byte(key)
+	}
+
 	return k.writer.WriteMessages(ctx, kafka.Message{
-		Topic: topic,
-		Value: msg,
+		Topic:   topic,
+		Key:     msgKey,
+		Value:   msg,
+		Headers: hs,
 	})
 }
 
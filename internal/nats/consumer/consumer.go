@@ -0,0 +1,171 @@
+package consumer
+
+import (
+	"context"
+	"log/slog"
+	"practice/internal/pkg/bus"
+	"practice/internal/pkg/errs"
+	"practice/internal/pkg/metrics"
+	"practice/internal/pkg/outbox"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pkg/errors"
+)
+
+// DeadLetterSuffix is appended to a subject to name its dead-letter subject.
+// It must be covered by the stream, as the default "practice.>" is.
+const DeadLetterSuffix = ".dlq"
+
+type Config struct {
+	Stream     string
+	Durable    string
+	Subject    string
+	MaxRetries int
+	Backoff    time.Duration
+	AckWait    time.Duration
+}
+
+// NatsConsumer pulls one subject through a durable consumer, so instances
+// sharing the durable name split the messages between them and resume
+// where the last one acked after a restart.
+type NatsConsumer struct {
+	cfg    Config
+	js     jetstream.JetStream
+	logger *slog.Logger
+}
+
+func NewNatsConsumer(js jetstream.JetStream, logger *slog.Logger, cfg Config) *NatsConsumer {
+	return &NatsConsumer{
+		cfg:    cfg,
+		js:     js,
+		logger: logger,
+	}
+}
+
+// Consume delivers messages to sub.Handler one at a time until ctx is
+// cancelled. Handled messages are acked; retryable failures are nakked
+// with exponential backoff until MaxRetries redeliveries, and anything
+// else is copied to the dead-letter subject and terminated. Messages left
+// unacked on shutdown are redelivered after AckWait.
+func (c *NatsConsumer) Consume(ctx context.Context, sub bus.Subscription) error {
+	cons, err := c.js.CreateOrUpdateConsumer(ctx, c.cfg.Stream, jetstream.ConsumerConfig{
+		Durable:       c.cfg.Durable,
+		FilterSubject: c.cfg.Subject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       c.cfg.AckWait,
+		// Redeliveries are counted here, so failures can be dead-lettered
+		// instead of silently dropped by the server.
+		MaxDeliver: -1,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error while creating consumer for %s", c.cfg.Subject)
+	}
+
+	// Prefetching one message keeps others available to the other
+	// instances and limits what a shutdown leaves waiting for AckWait.
+	messages, err := cons.Messages(jetstream.PullMaxMessages(1))
+	if err != nil {
+		return errors.Wrapf(err, "error while pulling %s", c.cfg.Subject)
+	}
+	defer messages.Stop()
+
+	stop := context.AfterFunc(ctx, messages.Stop)
+	defer stop()
+
+	drain := context.WithoutCancel(ctx)
+	lag := metrics.Lag.WithLabelValues(outbox.TransportNATS, c.cfg.Subject)
+
+	for {
+		msg, err := messages.Next()
+		if err != nil {
+			if errors.Is(err, jetstream.ErrMsgIteratorClosed) {
+				return nil
+			}
+			return errors.Wrap(err, "error while fetching message")
+		}
+
+		if meta, err := msg.Metadata(); err == nil {
+			lag.Set(float64(meta.NumPending))
+		}
+
+		c.handle(drain, msg, sub)
+	}
+}
+
+func (c *NatsConsumer) handle(ctx context.Context, msg jetstream.Msg, sub bus.Subscription) {
+	m := messageOf(msg)
+
+	err := sub.Handler(ctx, m)
+	if err == nil {
+		if err := msg.Ack(); err != nil {
+			c.logger.Error("error while acking message", "subject", msg.Subject(), "error", err.Error())
+		}
+		return
+	}
+
+	attempts := 1
+	if meta, err := msg.Metadata(); err == nil {
+		attempts = int(meta.NumDelivered)
+	}
+
+	if errs.Retryable(err) && attempts <= c.cfg.MaxRetries {
+		if err := msg.NakWithDelay(c.cfg.Backoff << (attempts - 1)); err != nil {
+			c.logger.Error("error while nakking message", "subject", msg.Subject(), "error", err.Error())
+		}
+		return
+	}
+
+	// Terminating without a dead-letter copy would lose the message, so
+	// it is redelivered until the copy is written.
+	if dlErr := c.sendToDeadLetter(ctx, msg, attempts, err); dlErr != nil {
+		c.logger.Error("error while dead-lettering message", "subject", msg.Subject(), "error", dlErr.Error())
+		_ = msg.NakWithDelay(c.cfg.Backoff)
+		return
+	}
+
+	if err := msg.Term(); err != nil {
+		c.logger.Error("error while terminating message", "subject", msg.Subject(), "error", err.Error())
+	}
+
+	if sub.OnDeadLetter != nil {
+		sub.OnDeadLetter(ctx, m, err)
+	}
+}
+
+func (c *NatsConsumer) sendToDeadLetter(ctx context.Context, msg jetstream.Msg, attempts int, cause error) error {
+	dl := nats.NewMsg(msg.Subject() + DeadLetterSuffix)
+	dl.Data = msg.Data()
+	for k, v := range msg.Headers() {
+		dl.Header[k] = v
+	}
+	// The stream would drop the copy as a duplicate of the original.
+	dl.Header.Del(jetstream.MsgIDHeader)
+
+	dl.Header.Set("x-original-subject", msg.Subject())
+	if meta, err := msg.Metadata(); err == nil {
+		dl.Header.Set("x-original-sequence", strconv.FormatUint(meta.Sequence.Stream, 10))
+	}
+	dl.Header.Set("x-attempts", strconv.Itoa(attempts))
+	dl.Header.Set("x-last-error", cause.Error())
+
+	_, err := c.js.PublishMsg(ctx, dl)
+	return err
+}
+
+func messageOf(msg jetstream.Msg) *bus.Message {
+	headers := make(map[string]string, len(msg.Headers()))
+	for k, v := range msg.Headers() {
+		if len(v) > 0 {
+			headers[k] = v[0]
+		}
+	}
+
+	return &bus.Message{
+		Topic:   msg.Subject(),
+		Headers: headers,
+		Payload: msg.Data(),
+	}
+}
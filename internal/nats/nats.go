@@ -0,0 +1,215 @@
+package nats
+
+import (
+	"context"
+	"log/slog"
+	"practice/internal/nats/consumer"
+	"practice/internal/pkg/bus"
+	"practice/internal/pkg/config"
+	"practice/internal/pkg/dedup"
+	"practice/internal/pkg/outbox"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pkg/errors"
+	"go.uber.org/fx"
+)
+
+const (
+	// setupTimeout bounds one attempt at creating or updating the stream.
+	setupTimeout = 10 * time.Second
+	// setupBackoff is the delay before the first retry of a failed stream
+	// setup, doubling up to maxSetupBackoff.
+	setupBackoff    = time.Second
+	maxSetupBackoff = time.Minute
+)
+
+// errNotReady is returned by publishes made before the stream is set up.
+var errNotReady = errors.New("nats stream is not ready")
+
+var Module = fx.Provide(fx.Annotate(New, fx.ResultTags(`group:"buses"`)))
+
+type Options struct {
+	fx.In
+	fx.Lifecycle
+	Cfg    *config.Config
+	Logger *slog.Logger
+}
+
+// Bus publishes to JetStream subjects of one stream and consumes each
+// subject through a durable pull consumer. NATS has no message keys, so
+// ordering is per subject and bus.Message.Key is not sent.
+type Bus struct {
+	cfg    *config.Config
+	logger *slog.Logger
+	conn   *nats.Conn
+	js     jetstream.JetStream
+
+	// ready is closed once the stream is set up.
+	ready  chan struct{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New connects to NATS in the background and creates or updates
+// NATS_STREAM as soon as the server is reachable, retrying with backoff, so
+// the bus is available even if the server is not up yet. Publishes fail and
+// subscriptions wait until the stream is set up; once connected, the
+// client reconnects on its own.
+func New(opts Options) (bus.Bus, error) {
+	if !slices.Contains(opts.Cfg.BUS_TRANSPORTS, outbox.TransportNATS) {
+		return nil, nil
+	}
+
+	b, err := connect(opts.Cfg, opts.Logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "error connecting nats")
+	}
+
+	opts.Lifecycle.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			b.Close()
+			return nil
+		},
+	})
+
+	return b, nil
+}
+
+// connect only fails on an invalid configuration; an unreachable server is
+// retried.
+func connect(cfg *config.Config, logger *slog.Logger) (*Bus, error) {
+	conn, err := nats.Connect(cfg.NATS_URL, nats.MaxReconnects(-1), nats.RetryOnFailedConnect(true))
+	if err != nil {
+		return nil, errors.Wrap(err, "error while connecting")
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "error while opening jetstream")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Bus{
+		cfg:    cfg,
+		logger: logger,
+		conn:   conn,
+		js:     js,
+		ready:  make(chan struct{}),
+		cancel: cancel,
+	}
+
+	b.wg.Add(1)
+	go b.setup(ctx)
+
+	return b, nil
+}
+
+// setup creates or updates the stream, retrying until it succeeds or ctx
+// is cancelled, then marks the bus ready.
+func (b *Bus) setup(ctx context.Context) {
+	defer b.wg.Done()
+
+	for attempt := 0; ; attempt++ {
+		err := b.declareStream(ctx)
+		if err == nil {
+			close(b.ready)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		delay := min(setupBackoff<<min(attempt, 16), maxSetupBackoff)
+		b.logger.Warn("nats stream not set up, retrying", "stream", b.cfg.NATS_STREAM, "retryIn", delay, "error", err.Error())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (b *Bus) declareStream(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, setupTimeout)
+	defer cancel()
+
+	_, err := b.js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     b.cfg.NATS_STREAM,
+		Subjects: b.cfg.NATS_STREAM_SUBJECTS,
+		Storage:  jetstream.FileStorage,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error while declaring stream %s", b.cfg.NATS_STREAM)
+	}
+	return nil
+}
+
+// Close stops setting up the stream and closes the connection.
+func (b *Bus) Close() {
+	b.cancel()
+	b.wg.Wait()
+	b.conn.Close()
+}
+
+func (b *Bus) Name() string {
+	return outbox.TransportNATS
+}
+
+// Publish waits for the stream to store msg, failing right away while the
+// stream is not set up. Its message id doubles as the
+// JetStream message id, so a publish repeated by the outbox relay within
+// the stream's duplicate window is stored once.
+func (b *Bus) Publish(ctx context.Context, msg *bus.Message) error {
+	select {
+	case <-b.ready:
+	default:
+		return errNotReady
+	}
+
+	m := nats.NewMsg(msg.Topic)
+	m.Data = msg.Payload
+	for k, v := range msg.Headers {
+		m.Header.Set(k, v)
+	}
+
+	var opts []jetstream.PublishOpt
+	if id := msg.Headers[dedup.Header]; id != "" {
+		opts = append(opts, jetstream.WithMsgID(id))
+	}
+
+	if _, err := b.js.PublishMsg(ctx, m, opts...); err != nil {
+		return errors.Wrapf(err, "error while publishing to %s", msg.Topic)
+	}
+	return nil
+}
+
+// Subscribe waits for the stream to be set up before consuming.
+func (b *Bus) Subscribe(ctx context.Context, sub bus.Subscription) error {
+	select {
+	case <-b.ready:
+	case <-ctx.Done():
+		return nil
+	}
+
+	return consumer.NewNatsConsumer(b.js, b.logger, consumer.Config{
+		Stream:     b.cfg.NATS_STREAM,
+		Durable:    durableName(b.cfg.NATS_DURABLE, sub.Topic),
+		Subject:    sub.Topic,
+		MaxRetries: b.cfg.NATS_MAX_RETRIES,
+		Backoff:    b.cfg.NATS_RETRY_BACKOFF,
+		AckWait:    b.cfg.NATS_ACK_WAIT,
+	}).Consume(ctx, sub)
+}
+
+// durableName derives a consumer name from subject, since names may not
+// contain the dots and wildcards subjects are made of.
+func durableName(prefix, subject string) string {
+	return prefix + "_" + strings.NewReplacer(".", "_", "*", "_", ">", "_").Replace(subject)
+}
@@ -0,0 +1,303 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"practice/internal/nats/consumer"
+	"practice/internal/pkg/bus"
+	"practice/internal/pkg/config"
+	"practice/internal/pkg/dedup"
+	"practice/internal/pkg/errs"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pkg/errors"
+)
+
+const (
+	subject = "practice.test.created"
+	timeout = 5 * time.Second
+)
+
+// startServer starts a JetStream server in-process on port, or on a random
+// one if port is -1.
+func startServer(t *testing.T, port int) *server.Server {
+	t.Helper()
+
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      port,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatalf("error while creating nats server: %v", err)
+	}
+
+	go srv.Start()
+	t.Cleanup(srv.Shutdown)
+	if !srv.ReadyForConnections(timeout) {
+		t.Fatal("nats server not ready")
+	}
+
+	return srv
+}
+
+// newBus starts a JetStream server in-process and connects a bus to it.
+func newBus(t *testing.T) *Bus {
+	t.Helper()
+
+	b := connectBus(t, startServer(t, -1).ClientURL())
+	receive(t, b.ready)
+	return b
+}
+
+func connectBus(t *testing.T, url string) *Bus {
+	t.Helper()
+
+	cfg := &config.Config{
+		NATS_URL:             url,
+		NATS_STREAM:          "TEST",
+		NATS_STREAM_SUBJECTS: []string{"practice.>"},
+		NATS_DURABLE:         "test",
+		NATS_MAX_RETRIES:     2,
+		NATS_RETRY_BACKOFF:   10 * time.Millisecond,
+		NATS_ACK_WAIT:        timeout,
+	}
+
+	b, err := connect(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("error while connecting: %v", err)
+	}
+	t.Cleanup(b.Close)
+
+	return b
+}
+
+// subscribe consumes subject with handler until the test ends.
+func subscribe(t *testing.T, b *Bus, handler bus.Handler, onDeadLetter func(context.Context, *bus.Message, error)) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Subscribe(ctx, bus.Subscription{
+			Topic:        subject,
+			Handler:      handler,
+			OnDeadLetter: onDeadLetter,
+		})
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("subscription failed: %v", err)
+		}
+	})
+}
+
+func publish(t *testing.T, b *Bus, id string) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := b.Publish(ctx, &bus.Message{
+		Topic:   subject,
+		Key:     "ignored",
+		Headers: map[string]string{dedup.Header: id, "x-test": "yes"},
+		Payload: []byte(`{"id":"` + id + `"}`),
+	})
+	if err != nil {
+		t.Fatalf("error while publishing: %v", err)
+	}
+}
+
+func receive[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(timeout):
+		t.Fatal("timed out")
+	}
+	panic("unreachable")
+}
+
+func TestPublishConsume(t *testing.T) {
+	b := newBus(t)
+
+	received := make(chan *bus.Message, 10)
+	subscribe(t, b, func(_ context.Context, msg *bus.Message) error {
+		received <- msg
+		return nil
+	}, nil)
+
+	publish(t, b, "m1")
+	// The relay may publish a message again; the stream keeps it once.
+	publish(t, b, "m1")
+	publish(t, b, "m2")
+
+	for _, id := range []string{"m1", "m2"} {
+		msg := receive(t, received)
+		if msg.Topic != subject {
+			t.Errorf("topic = %q, want %q", msg.Topic, subject)
+		}
+		if msg.Headers[dedup.Header] != id || msg.Headers["x-test"] != "yes" {
+			t.Errorf("headers = %v, want message id %q and x-test", msg.Headers, id)
+		}
+		if want := `{"id":"` + id + `"}`; string(msg.Payload) != want {
+			t.Errorf("payload = %s, want %s", msg.Payload, want)
+		}
+	}
+
+	select {
+	case msg := <-received:
+		t.Errorf("unexpected message %v", msg.Headers)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestServerStartedLater(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error while picking a port: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	b := connectBus(t, fmt.Sprintf("nats://127.0.0.1:%d", port))
+
+	err = b.Publish(context.Background(), &bus.Message{Topic: subject, Payload: []byte(`{}`)})
+	if !errors.Is(err, errNotReady) {
+		t.Fatalf("publish before the server started = %v, want %v", err, errNotReady)
+	}
+
+	received := make(chan *bus.Message, 1)
+	subscribe(t, b, func(_ context.Context, msg *bus.Message) error {
+		received <- msg
+		return nil
+	}, nil)
+
+	startServer(t, port)
+	select {
+	case <-b.ready:
+	case <-time.After(2 * maxSetupBackoff):
+		t.Fatal("stream not set up")
+	}
+
+	publish(t, b, "m1")
+	if msg := receive(t, received); msg.Headers[dedup.Header] != "m1" {
+		t.Errorf("message id = %q, want m1", msg.Headers[dedup.Header])
+	}
+}
+
+func TestRetryableFailureIsRedelivered(t *testing.T) {
+	b := newBus(t)
+
+	var attempts atomic.Int32
+	handled := make(chan int32, 1)
+	subscribe(t, b, func(context.Context, *bus.Message) error {
+		n := attempts.Add(1)
+		if n < 3 {
+			return errors.New("temporary failure")
+		}
+		handled <- n
+		return nil
+	}, func(context.Context, *bus.Message, error) {
+		t.Error("message dead-lettered")
+	})
+
+	publish(t, b, "m1")
+
+	if n := receive(t, handled); n != 3 {
+		t.Errorf("handled on attempt %d, want 3", n)
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		attempts string
+	}{
+		{"permanent failure", errs.Validation("invalid message"), "1"},
+		{"retries exhausted", errors.New("temporary failure"), "3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBus(t)
+
+			deadLettered := make(chan error, 1)
+			subscribe(t, b, func(context.Context, *bus.Message) error {
+				return tt.err
+			}, func(_ context.Context, msg *bus.Message, cause error) {
+				if msg.Headers[dedup.Header] != "m1" {
+					t.Errorf("dead-lettered message id = %q, want m1", msg.Headers[dedup.Header])
+				}
+				deadLettered <- cause
+			})
+
+			publish(t, b, "m1")
+
+			if cause := receive(t, deadLettered); cause.Error() != tt.err.Error() {
+				t.Errorf("cause = %v, want %v", cause, tt.err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			cons, err := b.js.OrderedConsumer(ctx, b.cfg.NATS_STREAM, jetstream.OrderedConsumerConfig{
+				FilterSubjects: []string{subject + consumer.DeadLetterSuffix},
+			})
+			if err != nil {
+				t.Fatalf("error while reading dead letters: %v", err)
+			}
+
+			dl, err := cons.Next(jetstream.FetchMaxWait(timeout))
+			if err != nil {
+				t.Fatalf("no dead letter: %v", err)
+			}
+
+			headers := dl.Headers()
+			if got := headers.Get("x-original-subject"); got != subject {
+				t.Errorf("x-original-subject = %q, want %q", got, subject)
+			}
+			if got := headers.Get("x-attempts"); got != tt.attempts {
+				t.Errorf("x-attempts = %q, want %q", got, tt.attempts)
+			}
+			if got := headers.Get("x-last-error"); got != tt.err.Error() {
+				t.Errorf("x-last-error = %q, want %q", got, tt.err.Error())
+			}
+			if got := headers.Get(dedup.Header); got != "m1" {
+				t.Errorf("message id = %q, want m1", got)
+			}
+			if string(dl.Data()) != `{"id":"m1"}` {
+				t.Errorf("payload = %s", dl.Data())
+			}
+
+			// The original is terminated, not redelivered.
+			info, err := b.js.Consumer(ctx, b.cfg.NATS_STREAM, durableName(b.cfg.NATS_DURABLE, subject))
+			if err != nil {
+				t.Fatalf("error while inspecting consumer: %v", err)
+			}
+			status, err := info.Info(ctx)
+			if err != nil {
+				t.Fatalf("error while inspecting consumer: %v", err)
+			}
+			if status.NumAckPending != 0 || status.NumPending != 0 {
+				t.Errorf("consumer has %d pending and %d unacked messages", status.NumPending, status.NumAckPending)
+			}
+		})
+	}
+}
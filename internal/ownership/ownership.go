@@ -0,0 +1,197 @@
+// Package ownership applies the ownership transfers queued when users are
+// deleted to their computers.
+//
+// Users live in Postgres and computers in MongoDB, with no transaction
+// spanning both, so ownership follows these rules:
+//
+//   - Postgres is authoritative for users. Assigning a computer locks its
+//     owner's row until the computer is written, so a user cannot be
+//     deleted, and its computers transferred, while it is given one.
+//   - Deleting a user queues the transfer of its computers in the deletion
+//     transaction. The job applies it at least once, until it succeeds;
+//     applying it again changes nothing.
+//   - Until then, the computers of a deleted user still name it as owner.
+//     Restoring the user before the transfer runs cancels it; restoring it
+//     later does not give the computers back.
+//   - Computers given to a user deleted in the meantime are unassigned.
+package ownership
+
+import (
+	"context"
+	"log/slog"
+	"practice/internal/pkg/audit"
+	"practice/internal/pkg/bus"
+	"practice/internal/pkg/config"
+	"practice/internal/pkg/errs"
+	"practice/internal/repository/postgres"
+	"practice/internal/repository/postgres/transfer"
+	"practice/internal/repository/postgres/user"
+	"practice/internal/service/computer"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/fx"
+)
+
+var Module = fx.Options(fx.Invoke(New))
+
+// maxBackoff caps the delay between attempts of a failing transfer.
+const maxBackoff = 5 * time.Minute
+
+type Options struct {
+	fx.In
+	fx.Lifecycle
+	Cfg                *config.Config
+	Logger             *slog.Logger
+	Postgres           *postgres.Postgres
+	TransferRepository transfer.RepositoryTransfer
+	UserRepository     user.RepositoryUser
+	ComputerService    computer.ServiceComputer
+}
+
+// Job applies the due ownership transfers every OWNERSHIP_POLL_INTERVAL.
+// Every instance runs it; Next skips the transfers another instance is
+// applying.
+type Job struct {
+	cfg       *config.Config
+	logger    *slog.Logger
+	postgres  *postgres.Postgres
+	transfers transfer.RepositoryTransfer
+	users     user.RepositoryUser
+	computers computer.ServiceComputer
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+func New(opts Options) (*Job, error) {
+	if opts.Cfg.OWNERSHIP_POLL_INTERVAL <= 0 {
+		return nil, errors.New("OWNERSHIP_POLL_INTERVAL must be positive")
+	}
+	if opts.Cfg.OWNERSHIP_RETRY_BACKOFF <= 0 {
+		return nil, errors.New("OWNERSHIP_RETRY_BACKOFF must be positive")
+	}
+
+	job := &Job{
+		cfg:       opts.Cfg,
+		logger:    opts.Logger,
+		postgres:  opts.Postgres,
+		transfers: opts.TransferRepository,
+		users:     opts.UserRepository,
+		computers: opts.ComputerService,
+	}
+
+	opts.Lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			ctx := bus.WithActor(context.Background(), bus.ActorSystem)
+			ctx, cancel := context.WithCancel(audit.WithSource(ctx, audit.SourceSystem))
+			job.cancel = cancel
+
+			job.wg.Add(1)
+			go job.run(ctx)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			job.cancel()
+			job.wg.Wait()
+			return nil
+		},
+	})
+
+	return job, nil
+}
+
+func (j *Job) run(ctx context.Context) {
+	defer j.wg.Done()
+
+	ticker := time.NewTicker(j.cfg.OWNERSHIP_POLL_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		// Drain what is due before waiting again.
+		for ctx.Err() == nil {
+			if !j.step(ctx) {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// step applies the next due transfer, if any, and reports whether there may
+// be more.
+func (j *Job) step(ctx context.Context) bool {
+	var t *transfer.Transfer
+	err := j.postgres.Tx(ctx, func(ctx context.Context) error {
+		var err error
+		if t, err = j.transfers.Next(ctx); err != nil || t == nil {
+			return err
+		}
+		if err := j.apply(ctx, t); err != nil {
+			return err
+		}
+		return j.transfers.Done(ctx, t.ID)
+	})
+	if err == nil {
+		return t != nil
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+	if t == nil {
+		j.logger.Error("ownership transfer lookup failed", "error", err.Error())
+		return false
+	}
+
+	backoff := min(j.cfg.OWNERSHIP_RETRY_BACKOFF<<min(t.Attempts, 16), maxBackoff)
+	j.logger.Error("ownership transfer failed",
+		"transfer", t.ID, "from", t.From, "to", t.To, "attempts", t.Attempts+1,
+		"retryIn", backoff, "error", err.Error())
+
+	if err := j.transfers.Fail(ctx, t.ID, err.Error(), time.Now().Add(backoff)); err != nil {
+		j.logger.Error("ownership transfer not rescheduled", "transfer", t.ID, "error", err.Error())
+		return false
+	}
+	return true
+}
+
+// apply gives the computers of t.From to t.To, holding both users until
+// the transaction carried by ctx ends. Changes are attributed to the
+// deletion that queued t.
+func (j *Job) apply(ctx context.Context, t *transfer.Transfer) error {
+	from, err := j.users.Find(ctx, t.From)
+	if err != nil && !errs.Is(err, errs.KindNotFound) {
+		return err
+	}
+	if from != nil && !from.IsDeleted {
+		j.logger.Info("ownership transfer cancelled by restore", "transfer", t.ID, "from", t.From)
+		return nil
+	}
+
+	to := t.To
+	if to != "" {
+		owner, err := j.users.Find(ctx, to)
+		if err != nil && !errs.Is(err, errs.KindNotFound) {
+			return err
+		}
+		if owner == nil || owner.IsDeleted {
+			to = ""
+		}
+	}
+
+	ctx = bus.WithCorrelationID(bus.WithActor(ctx, t.Actor), t.RequestID)
+	n, err := j.computers.Reassign(ctx, t.From, to)
+	if err != nil {
+		return err
+	}
+
+	if n > 0 {
+		j.logger.Info("computers transferred", "transfer", t.ID, "from", t.From, "to", to, "count", n)
+	}
+	return nil
+}
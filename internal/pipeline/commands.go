@@ -0,0 +1,131 @@
+package pipeline
+
+import (
+	"context"
+	"practice/internal/pkg/bus"
+	"practice/internal/pkg/codec"
+	repoComp "practice/internal/repository/mongodb/computer"
+	repoUser "practice/internal/repository/postgres/user"
+
+	"github.com/pkg/errors"
+)
+
+func (p *Pipeline) createUser(ctx context.Context, msg *bus.Message) error {
+	var req repoUser.User
+	if err := p.codecs.Decode(codec.SubjectUser, msg.Headers, msg.Payload, &req); err != nil {
+		return errors.Wrap(err, "error while decoding user")
+	}
+
+	resp, err := p.user.Create(ctx, &req)
+	if err != nil {
+		return errors.Wrap(err, "error while creating user")
+	}
+
+	p.logger.Info("created user", "user", resp)
+	return nil
+}
+
+func (p *Pipeline) updateUser(ctx context.Context, msg *bus.Message) error {
+	var req repoUser.User
+	if err := p.codecs.Decode(codec.SubjectUser, msg.Headers, msg.Payload, &req); err != nil {
+		return errors.Wrap(err, "error while decoding user")
+	}
+
+	resp, err := p.user.Update(ctx, &req)
+	if err != nil {
+		return errors.Wrap(err, "error while updating user")
+	}
+
+	p.logger.Info("updated user", "id", resp)
+	return nil
+}
+
+func (p *Pipeline) patchUser(ctx context.Context, msg *bus.Message) error {
+	var req repoUser.Patch
+	if err := p.codecs.Decode(codec.SubjectUserPatch, msg.Headers, msg.Payload, &req); err != nil {
+		return errors.Wrap(err, "error while decoding user patch")
+	}
+
+	resp, err := p.user.Patch(ctx, &req)
+	if err != nil {
+		return errors.Wrap(err, "error while patching user")
+	}
+
+	p.logger.Info("patched user", "id", resp, "fields", req.Fields)
+	return nil
+}
+
+func (p *Pipeline) deleteUser(ctx context.Context, msg *bus.Message) error {
+	req, err := p.codecs.DecodeDelete(msg.Headers, msg.Payload)
+	if err != nil {
+		return errors.Wrap(err, "error while decoding user id")
+	}
+
+	resp, err := p.user.Delete(ctx, req.ID, req.ReassignTo)
+	if err != nil {
+		return errors.Wrap(err, "error while deleting user")
+	}
+
+	p.logger.Info("deleted user", "id", resp)
+	return nil
+}
+
+func (p *Pipeline) createComputer(ctx context.Context, msg *bus.Message) error {
+	var req repoComp.Computer
+	if err := p.codecs.Decode(codec.SubjectComputer, msg.Headers, msg.Payload, &req); err != nil {
+		return errors.Wrap(err, "error while decoding computer")
+	}
+
+	resp, err := p.computer.Create(ctx, &req)
+	if err != nil {
+		return errors.Wrap(err, "error while creating computer")
+	}
+
+	p.logger.Info("created computer", "computer", resp)
+	return nil
+}
+
+func (p *Pipeline) updateComputer(ctx context.Context, msg *bus.Message) error {
+	var req repoComp.Computer
+	if err := p.codecs.Decode(codec.SubjectComputer, msg.Headers, msg.Payload, &req); err != nil {
+		return errors.Wrap(err, "error while decoding computer")
+	}
+
+	resp, err := p.computer.Update(ctx, &req)
+	if err != nil {
+		return errors.Wrap(err, "error while updating computer")
+	}
+
+	p.logger.Info("updated computer", "id", resp)
+	return nil
+}
+
+func (p *Pipeline) patchComputer(ctx context.Context, msg *bus.Message) error {
+	var req repoComp.Patch
+	if err := p.codecs.Decode(codec.SubjectComputerPatch, msg.Headers, msg.Payload, &req); err != nil {
+		return errors.Wrap(err, "error while decoding computer patch")
+	}
+
+	resp, err := p.computer.Patch(ctx, &req)
+	if err != nil {
+		return errors.Wrap(err, "error while patching computer")
+	}
+
+	p.logger.Info("patched computer", "id", resp, "fields", req.Fields)
+	return nil
+}
+
+func (p *Pipeline) deleteComputer(ctx context.Context, msg *bus.Message) error {
+	req, err := p.codecs.DecodeDelete(msg.Headers, msg.Payload)
+	if err != nil {
+		return errors.Wrap(err, "error while decoding computer id")
+	}
+
+	resp, err := p.computer.Delete(ctx, req.ID)
+	if err != nil {
+		return errors.Wrap(err, "error while deleting computer")
+	}
+
+	p.logger.Info("deleted computer", "id", resp)
+	return nil
+}
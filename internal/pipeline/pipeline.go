@@ -0,0 +1,353 @@
+package pipeline
+
+import (
+	"context"
+	"log/slog"
+	"practice/internal/pkg/audit"
+	"practice/internal/pkg/bus"
+	"practice/internal/pkg/codec"
+	"practice/internal/pkg/command"
+	"practice/internal/pkg/config"
+	"practice/internal/pkg/dedup"
+	"practice/internal/pkg/errs"
+	"practice/internal/pkg/metrics"
+	"practice/internal/pkg/outbox"
+	"practice/internal/repository/mongodb"
+	mongoCommand "practice/internal/repository/mongodb/command"
+	mongoOutbox "practice/internal/repository/mongodb/outbox"
+	"practice/internal/repository/postgres"
+	pgCommand "practice/internal/repository/postgres/command"
+	pgOutbox "practice/internal/repository/postgres/outbox"
+	"practice/internal/service/computer"
+	"practice/internal/service/user"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.uber.org/fx"
+)
+
+var Module = fx.Provide(New)
+
+// Subscriptions that stop with an error are resubscribed after a delay
+// doubling from resubscribeBackoff up to maxResubscribeBackoff.
+const (
+	resubscribeBackoff    = time.Second
+	maxResubscribeBackoff = time.Minute
+)
+
+// Command types reported by GET /commands/{id}.
+const (
+	CreateUser     = "create_user"
+	UpdateUser     = "update_user"
+	PatchUser      = "patch_user"
+	DeleteUser     = "delete_user"
+	CreateComputer = "create_computer"
+	UpdateComputer = "update_computer"
+	PatchComputer  = "patch_computer"
+	DeleteComputer = "delete_computer"
+)
+
+type Options struct {
+	fx.In
+	fx.Lifecycle
+	Cfg    *config.Config
+	Logger *slog.Logger
+
+	Postgres         *postgres.Postgres
+	Mongo            *mongodb.MongoDB
+	UserService      user.ServiceUser
+	ComputerService  computer.ServiceComputer
+	UserOutbox       pgOutbox.RepositoryOutbox
+	ComputerOutbox   mongoOutbox.RepositoryOutbox
+	UserCommands     pgCommand.RepositoryCommand
+	ComputerCommands mongoCommand.RepositoryCommand
+	Codecs           *codec.Codecs
+	Buses            *bus.Registry
+}
+
+// sink is the database that owns an aggregate. Commands on it are recorded
+// there together with their outbox message.
+type sink struct {
+	tx       func(ctx context.Context, fn func(ctx context.Context) error) error
+	commands command.Store
+	outbox   outbox.Store
+}
+
+// route describes a command type: the subject its payload is encoded
+// under, the database tracking it and how a received message is applied.
+type route struct {
+	subject string
+	sink    sink
+	apply   func(ctx context.Context, msg *bus.Message) error
+}
+
+// Pipeline carries async commands end to end on any bus: Send records them
+// for the outbox relay to publish, and every available bus is subscribed
+// to every command topic to apply them through the services.
+type Pipeline struct {
+	cfg      *config.Config
+	logger   *slog.Logger
+	codecs   *codec.Codecs
+	buses    *bus.Registry
+	user     user.ServiceUser
+	computer computer.ServiceComputer
+	routes   map[string]route
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func New(opts Options) *Pipeline {
+	users := sink{
+		tx:       opts.Postgres.Tx,
+		commands: opts.UserCommands,
+		outbox:   opts.UserOutbox,
+	}
+	computers := sink{
+		tx:       opts.Mongo.Tx,
+		commands: opts.ComputerCommands,
+		outbox:   opts.ComputerOutbox,
+	}
+
+	p := &Pipeline{
+		cfg:      opts.Cfg,
+		logger:   opts.Logger,
+		codecs:   opts.Codecs,
+		buses:    opts.Buses,
+		user:     opts.UserService,
+		computer: opts.ComputerService,
+	}
+
+	p.routes = map[string]route{
+		CreateUser:     {codec.SubjectUser, users, p.createUser},
+		UpdateUser:     {codec.SubjectUser, users, p.updateUser},
+		PatchUser:      {codec.SubjectUserPatch, users, p.patchUser},
+		DeleteUser:     {codec.SubjectDelete, users, p.deleteUser},
+		CreateComputer: {codec.SubjectComputer, computers, p.createComputer},
+		UpdateComputer: {codec.SubjectComputer, computers, p.updateComputer},
+		PatchComputer:  {codec.SubjectComputerPatch, computers, p.patchComputer},
+		DeleteComputer: {codec.SubjectDelete, computers, p.deleteComputer},
+	}
+
+	opts.Lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			// The start context is cancelled once the app has started, so
+			// subscriptions get their own, cancelled in OnStop.
+			ctx, cancel := context.WithCancel(context.Background())
+			p.cancel = cancel
+
+			for _, name := range p.buses.Names() {
+				b, _ := p.buses.Get(name)
+				for typ, route := range p.routes {
+					p.wg.Add(1)
+					go p.consume(ctx, b, typ, route)
+				}
+			}
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			p.cancel()
+
+			done := make(chan struct{})
+			go func() {
+				p.wg.Wait()
+				close(done)
+			}()
+
+			select {
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				return errors.Wrap(ctx.Err(), "error while draining command subscriptions")
+			}
+		},
+	})
+
+	return p
+}
+
+// Send encodes payload and records a pending command of type typ and its
+// message for transport in one transaction instead of publishing directly,
+// so it survives broker outages; the outbox relay delivers it. The command
+// id doubles as the message id consumers use to ignore redeliveries and to
+// report the outcome. key orders or routes the message within its topic.
+func (p *Pipeline) Send(ctx context.Context, transport, typ, key string, payload any) (*command.Command, error) {
+	route, ok := p.routes[typ]
+	if !ok {
+		return nil, errors.Errorf("unknown command type %q", typ)
+	}
+
+	data, headers, err := p.codecs.Encode(route.subject, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := &command.Command{
+		ID:   uuid.NewString(),
+		Type: typ,
+	}
+	headers[dedup.Header] = cmd.ID
+	if id := bus.CorrelationID(ctx); id != "" {
+		headers[bus.HeaderCorrelationID] = id
+	}
+	if actor := bus.Actor(ctx); actor != "" {
+		headers[bus.HeaderActor] = actor
+	}
+
+	err = route.sink.tx(ctx, func(ctx context.Context) error {
+		if err := route.sink.commands.Add(ctx, cmd); err != nil {
+			return err
+		}
+
+		return route.sink.outbox.Add(ctx, &outbox.Message{
+			Transport: transport,
+			Topic:     topics(p.cfg, transport)[typ],
+			Key:       key,
+			Headers:   headers,
+			Payload:   data,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cmd, nil
+}
+
+// consume subscribes to the topic of typ on b until ctx is cancelled.
+// Subscriptions end with an error when a consumer fails, such as a Kafka
+// commit failing during a rebalance or a NATS fetch failing, so they are
+// resubscribed with backoff.
+func (p *Pipeline) consume(ctx context.Context, b bus.Bus, typ string, route route) {
+	defer p.wg.Done()
+
+	topic := topics(p.cfg, b.Name())[typ]
+	sub := bus.Subscription{
+		Topic:        topic,
+		Handler:      p.handle(b.Name(), topic, route),
+		OnDeadLetter: p.fail(route),
+	}
+
+	for attempt := 0; ; attempt++ {
+		p.logger.Info("command subscription started", "transport", b.Name(), "topic", topic)
+
+		start := time.Now()
+		err := b.Subscribe(ctx, sub)
+		if ctx.Err() != nil || err == nil {
+			p.logger.Info("command subscription stopped", "transport", b.Name(), "topic", topic)
+			return
+		}
+
+		// A subscription that ran for a while failed afresh.
+		if time.Since(start) > maxResubscribeBackoff {
+			attempt = 0
+		}
+
+		delay := min(resubscribeBackoff<<min(attempt, 16), maxResubscribeBackoff)
+		p.logger.Error("command subscription failed, resubscribing",
+			"transport", b.Name(), "topic", topic, "retryIn", delay, "error", err.Error())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// handle applies a received command with its message id in ctx, so the
+// service records it as processed and completes the command, and with its
+// correlation id and actor, so the events and changes it causes carry them
+// on, with the transport as their source. Redeliveries of processed
+// messages are acknowledged without effect.
+func (p *Pipeline) handle(transport, topic string, route route) bus.Handler {
+	inFlight := metrics.InFlight.WithLabelValues(transport, topic)
+	duration := metrics.HandleDuration.WithLabelValues(transport, topic)
+
+	return func(ctx context.Context, msg *bus.Message) error {
+		p.logger.Info("received command",
+			"topic", msg.Topic, "bytes", len(msg.Payload), "contentType", msg.Headers[codec.HeaderContentType],
+			"correlationId", msg.Headers[bus.HeaderCorrelationID])
+
+		inFlight.Inc()
+		start := time.Now()
+		defer func() {
+			inFlight.Dec()
+			duration.Observe(time.Since(start).Seconds())
+		}()
+
+		ctx = bus.WithCorrelationID(ctx, msg.Headers[bus.HeaderCorrelationID])
+		ctx = bus.WithActor(ctx, msg.Headers[bus.HeaderActor])
+		ctx = audit.WithSource(ctx, transport)
+		err := route.apply(dedup.WithMessageID(ctx, msg.Headers[dedup.Header]), msg)
+
+		outcome := "error"
+		switch {
+		case err == nil:
+			outcome = "ok"
+		case errors.Is(err, dedup.ErrDuplicate):
+			outcome, err = "duplicate", nil
+			p.logger.Info("skipped already processed message", "topic", msg.Topic, "messageId", msg.Headers[dedup.Header])
+		case errs.Is(err, errs.KindValidation):
+			p.logger.Error("rejected invalid message", "topic", msg.Topic, "error", err.Error(), "fields", errs.FieldsOf(err))
+		default:
+			p.logger.Error("error while applying command", "topic", msg.Topic, "error", err.Error())
+		}
+		metrics.Handled.WithLabelValues(transport, topic, outcome).Inc()
+
+		return err
+	}
+}
+
+// fail records the outcome of dead-lettered commands so clients polling
+// their status learn about the failure.
+func (p *Pipeline) fail(route route) func(ctx context.Context, msg *bus.Message, cause error) {
+	return func(ctx context.Context, msg *bus.Message, cause error) {
+		ctx = dedup.WithMessageID(ctx, msg.Headers[dedup.Header])
+		if err := command.Fail(ctx, route.sink.commands, cause); err != nil {
+			p.logger.Error("error while recording failed command", "topic", msg.Topic, "error", err.Error())
+		}
+	}
+}
+
+// topics names the topic of every command type on transport. RabbitMQ
+// and NATS keep their own queue and subject names; the other buses use the
+// Kafka topic names.
+func topics(cfg *config.Config, transport string) map[string]string {
+	switch transport {
+	case outbox.TransportRabbitMQ:
+		return map[string]string{
+			CreateUser:     cfg.RabbitMQ_QUEUE_USER_CREATED,
+			UpdateUser:     cfg.RabbitMQ_QUEUE_USER_UPDATED,
+			PatchUser:      cfg.RabbitMQ_QUEUE_USER_PATCHED,
+			DeleteUser:     cfg.RabbitMQ_QUEUE_USER_DELETED,
+			CreateComputer: cfg.RabbitMQ_QUEUE_COMPUTER_CREATED,
+			UpdateComputer: cfg.RabbitMQ_QUEUE_COMPUTER_UPDATED,
+			PatchComputer:  cfg.RabbitMQ_QUEUE_COMPUTER_PATCHED,
+			DeleteComputer: cfg.RabbitMQ_QUEUE_COMPUTER_DELETED,
+		}
+	case outbox.TransportNATS:
+		return map[string]string{
+			CreateUser:     cfg.NATS_SUBJECT_USER_CREATED,
+			UpdateUser:     cfg.NATS_SUBJECT_USER_UPDATED,
+			PatchUser:      cfg.NATS_SUBJECT_USER_PATCHED,
+			DeleteUser:     cfg.NATS_SUBJECT_USER_DELETED,
+			CreateComputer: cfg.NATS_SUBJECT_COMPUTER_CREATED,
+			UpdateComputer: cfg.NATS_SUBJECT_COMPUTER_UPDATED,
+			PatchComputer:  cfg.NATS_SUBJECT_COMPUTER_PATCHED,
+			DeleteComputer: cfg.NATS_SUBJECT_COMPUTER_DELETED,
+		}
+	}
+
+	return map[string]string{
+		CreateUser:     cfg.KAFKA_TOPIC_USER_CREATED,
+		UpdateUser:     cfg.KAFKA_TOPIC_USER_UPDATED,
+		PatchUser:      cfg.KAFKA_TOPIC_USER_PATCHED,
+		DeleteUser:     cfg.KAFKA_TOPIC_USER_DELETED,
+		CreateComputer: cfg.KAFKA_TOPIC_COMPUTER_CREATED,
+		UpdateComputer: cfg.KAFKA_TOPIC_COMPUTER_UPDATED,
+		PatchComputer:  cfg.KAFKA_TOPIC_COMPUTER_PATCHED,
+		DeleteComputer: cfg.KAFKA_TOPIC_COMPUTER_DELETED,
+	}
+}
@@ -0,0 +1,165 @@
+package audit
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"practice/internal/pkg/bus"
+	"practice/internal/pkg/dedup"
+	"practice/internal/pkg/errs"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Entities whose changes are audited.
+const (
+	EntityUser     = "user"
+	EntityComputer = "computer"
+)
+
+type Action string
+
+const (
+	ActionCreated  Action = "created"
+	ActionUpdated  Action = "updated"
+	ActionDeleted  Action = "deleted"
+	ActionRestored Action = "restored"
+	ActionPurged   Action = "purged"
+)
+
+// Sources of changes other than messages, whose source is the name of the
+// bus they came in on.
+const (
+	SourceHTTP   = "http"
+	SourceSystem = "system"
+)
+
+// Entry is one change to an entity. Before and After are the JSON forms of
+// the entity around the change, absent before creation and after purging.
+type Entry struct {
+	ID       string         `json:"id" bson:"_id"`
+	Entity   string         `json:"entity" bson:"entity"`
+	EntityID string         `json:"entityId" bson:"entityId"`
+	Action   Action         `json:"action" bson:"action"`
+	Version  int            `json:"version" bson:"version"`
+	Before   map[string]any `json:"before,omitempty" bson:"before,omitempty"`
+	After    map[string]any `json:"after,omitempty" bson:"after,omitempty"`
+	Actor    string         `json:"actor,omitempty" bson:"actor"`
+	Source   string         `json:"source,omitempty" bson:"source"`
+	// RequestID is the correlation id of the request behind the change and
+	// MessageID the id of the command message that applied it, if any.
+	RequestID string    `json:"requestId,omitempty" bson:"requestId"`
+	MessageID string    `json:"messageId,omitempty" bson:"messageId"`
+	ChangedAt time.Time `json:"changedAt" bson:"changedAt"`
+}
+
+// ListParams describes one page of the history of an entity, newest change
+// first. Cursor is the opaque token returned as Page.NextCursor.
+type ListParams struct {
+	Limit  int
+	Cursor string
+}
+
+type Page struct {
+	Items      []*Entry `json:"items"`
+	NextCursor string   `json:"nextCursor,omitempty"`
+}
+
+// Store is implemented by the audit log of every database that owns
+// entities. It is append-only: entries outlive the entities they describe,
+// purged ones included. Add must join the transaction carried by ctx.
+type Store interface {
+	Add(ctx context.Context, entry *Entry) error
+	List(ctx context.Context, entity, entityID string, params *ListParams) (*Page, error)
+}
+
+type sourceKey struct{}
+
+// WithSource returns a copy of ctx carrying where the request or message
+// being handled came from.
+func WithSource(ctx context.Context, source string) context.Context {
+	if source == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, sourceKey{}, source)
+}
+
+// Source returns the source carried by ctx, if any.
+func Source(ctx context.Context) string {
+	source, _ := ctx.Value(sourceKey{}).(string)
+	return source
+}
+
+// Record appends a change of the entity at version to store, attributed to
+// the actor, source, correlation id and message id carried by ctx. It must
+// be called in the transaction that made the change, so the entry is kept
+// if and only if the change commits.
+func Record(ctx context.Context, store Store, entity string, action Action, entityID string, version int, before, after any) error {
+	entry := &Entry{
+		ID:        uuid.NewString(),
+		Entity:    entity,
+		EntityID:  entityID,
+		Action:    action,
+		Version:   version,
+		Actor:     bus.Actor(ctx),
+		Source:    Source(ctx),
+		RequestID: bus.CorrelationID(ctx),
+		MessageID: dedup.MessageID(ctx),
+		ChangedAt: time.Now().UTC(),
+	}
+
+	var err error
+	if entry.Before, err = snapshot(before); err != nil {
+		return err
+	}
+	if entry.After, err = snapshot(after); err != nil {
+		return err
+	}
+
+	return store.Add(ctx, entry)
+}
+
+// snapshot is the JSON form of v, nil for nil values.
+func snapshot(v any) (map[string]any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "error while encoding audit snapshot")
+	}
+
+	var res map[string]any
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, errors.Wrap(err, "error while encoding audit snapshot")
+	}
+
+	return res, nil
+}
+
+// Cursor is the position after the last entry of a page, in the order of
+// ChangedAt and then ID, both descending.
+type Cursor struct {
+	ChangedAt time.Time `json:"at"`
+	ID        string    `json:"id"`
+}
+
+// NextCursor returns the token of the page following the one ending with
+// last.
+func NextCursor(last *Entry) string {
+	b, _ := json.Marshal(Cursor{ChangedAt: last.ChangedAt, ID: last.ID})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func DecodeCursor(token string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errs.Wrap(errs.KindValidation, err, "invalid cursor")
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, errs.Wrap(errs.KindValidation, err, "invalid cursor")
+	}
+
+	return &c, nil
+}
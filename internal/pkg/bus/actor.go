@@ -0,0 +1,28 @@
+package bus
+
+import "context"
+
+// HeaderActor names the header carrying who caused a message, so changes
+// applied by consumers are attributed like the request that sent them.
+const HeaderActor = "actor"
+
+// ActorSystem is the actor of changes made by the service itself, such as
+// the retention job.
+const ActorSystem = "system"
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx carrying the actor of the request or
+// message being handled.
+func WithActor(ctx context.Context, actor string) context.Context {
+	if actor == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// Actor returns the actor carried by ctx, if any.
+func Actor(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
@@ -0,0 +1,140 @@
+package bus
+
+import (
+	"context"
+	"log/slog"
+	"practice/internal/pkg/config"
+	"slices"
+
+	"go.uber.org/fx"
+)
+
+var Module = fx.Provide(NewRegistry)
+
+// Message is what travels on a bus. Topic names the stream or queue, Key
+// partitions or routes it within the topic, and Headers carry metadata such
+// as the message id and content type.
+type Message struct {
+	Topic   string
+	Key     string
+	Headers map[string]string
+	Payload []byte
+}
+
+// Handler processes one delivered message. Returning nil acknowledges it.
+// Errors for which errs.Retryable holds are redelivered with backoff up to
+// the transport's retry limit; any other error, or running out of retries,
+// moves the message to the topic's dead letters.
+type Handler func(ctx context.Context, msg *Message) error
+
+// Subscription binds a handler to a topic.
+type Subscription struct {
+	Topic   string
+	Handler Handler
+	// OnDeadLetter, if set, is called once a message has been given up on
+	// and stored as a dead letter.
+	OnDeadLetter func(ctx context.Context, msg *Message, cause error)
+}
+
+// Bus is a message transport.
+type Bus interface {
+	// Name is the transport name used by outbox messages and config.
+	Name() string
+	Publish(ctx context.Context, msg *Message) error
+	// Subscribe delivers the messages of sub.Topic to sub.Handler until ctx
+	// is cancelled, then returns nil once the message in flight, if any,
+	// has been handled and acknowledged. Handlers run with a context that
+	// is not cancelled with ctx, so shutdown does not abort them halfway.
+	Subscribe(ctx context.Context, sub Subscription) error
+}
+
+// DeadLetterStore is implemented by buses that keep dead letters where
+// they can be inspected and replayed.
+type DeadLetterStore interface {
+	DeadLetterQueues() ([]DeadLetterQueue, error)
+	// PeekDeadLetters returns up to limit dead letters of topic without
+	// removing them.
+	PeekDeadLetters(topic string, limit int) ([]DeadLetter, error)
+	// ReplayDeadLetters moves up to limit dead letters of topic back to it
+	// with a fresh attempt count.
+	ReplayDeadLetters(topic string, limit int) (int, error)
+}
+
+type DeadLetterQueue struct {
+	Queue      string `json:"queue"`
+	DeadLetter string `json:"deadLetterQueue"`
+	Messages   int    `json:"messages"`
+}
+
+type DeadLetter struct {
+	MessageID      string         `json:"messageId,omitempty"`
+	Queue          string         `json:"queue"`
+	Attempts       int            `json:"attempts"`
+	LastError      string         `json:"lastError,omitempty"`
+	DeadLetteredAt string         `json:"deadLetteredAt,omitempty"`
+	ContentType    string         `json:"contentType,omitempty"`
+	Headers        map[string]any `json:"headers,omitempty"`
+	Body           string         `json:"body"`
+}
+
+type RegistryOptions struct {
+	fx.In
+	Cfg    *config.Config
+	Logger *slog.Logger
+	// Buses are contributed by the transport modules. A transport that is
+	// not listed in BUS_TRANSPORTS, or could not be set up, contributes nil.
+	Buses []Bus `group:"buses"`
+}
+
+// Registry holds the buses enabled by BUS_TRANSPORTS, in that order.
+type Registry struct {
+	buses map[string]Bus
+	names []string
+}
+
+func NewRegistry(opts RegistryOptions) *Registry {
+	registry := &Registry{buses: map[string]Bus{}}
+
+	for _, b := range opts.Buses {
+		if b != nil {
+			registry.buses[b.Name()] = b
+		}
+	}
+
+	for _, name := range opts.Cfg.BUS_TRANSPORTS {
+		if _, ok := registry.buses[name]; !ok {
+			opts.Logger.Warn("bus transport is not available", "transport", name)
+			continue
+		}
+		registry.names = append(registry.names, name)
+	}
+
+	return registry
+}
+
+// Get returns the bus named name if it is enabled and available.
+func (r *Registry) Get(name string) (Bus, bool) {
+	if !slices.Contains(r.names, name) {
+		return nil, false
+	}
+	return r.buses[name], true
+}
+
+// Names lists the available buses.
+func (r *Registry) Names() []string {
+	return r.names
+}
+
+// DeadLetters returns the bus named name as a DeadLetterStore, or the first
+// available bus that keeps dead letters when name is empty.
+func (r *Registry) DeadLetters(name string) (DeadLetterStore, bool) {
+	for _, n := range r.names {
+		if name != "" && n != name {
+			continue
+		}
+		if store, ok := r.buses[n].(DeadLetterStore); ok {
+			return store, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,25 @@
+package bus
+
+import "context"
+
+// HeaderCorrelationID names the header, or AMQP correlation-id property,
+// tying a message to the request that caused it, so one request can be
+// followed through commands, events and logs.
+const HeaderCorrelationID = "correlation-id"
+
+type correlationIDKey struct{}
+
+// WithCorrelationID returns a copy of ctx carrying the correlation id of
+// the request or message being handled.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationID returns the correlation id carried by ctx, if any.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
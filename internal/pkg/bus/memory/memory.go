@@ -0,0 +1,215 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"practice/internal/pkg/bus"
+	"practice/internal/pkg/codec"
+	"practice/internal/pkg/config"
+	"practice/internal/pkg/dedup"
+	"practice/internal/pkg/errs"
+	"practice/internal/pkg/metrics"
+	"practice/internal/pkg/outbox"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/fx"
+)
+
+const (
+	// topicCapacity bounds the messages waiting on a topic. Publishing to a
+	// full topic fails instead of blocking, so the outbox retries it later.
+	topicCapacity = 1024
+	maxRetries    = 3
+	retryBackoff  = 100 * time.Millisecond
+)
+
+var Module = fx.Provide(fx.Annotate(New, fx.ResultTags(`group:"buses"`)))
+
+type Options struct {
+	fx.In
+	Cfg    *config.Config
+	Logger *slog.Logger
+}
+
+// Bus delivers messages through in-process channels, so the whole app can
+// run without brokers. Each message goes to one subscriber of its topic,
+// and anything not yet handled is lost on restart.
+type Bus struct {
+	logger      *slog.Logger
+	mu          sync.Mutex
+	topics      map[string]chan *bus.Message
+	deadLetters map[string][]bus.DeadLetter
+}
+
+func New(opts Options) bus.Bus {
+	if !slices.Contains(opts.Cfg.BUS_TRANSPORTS, outbox.TransportMemory) {
+		return nil
+	}
+
+	return &Bus{
+		logger:      opts.Logger,
+		topics:      map[string]chan *bus.Message{},
+		deadLetters: map[string][]bus.DeadLetter{},
+	}
+}
+
+func (b *Bus) Name() string {
+	return outbox.TransportMemory
+}
+
+func (b *Bus) Publish(_ context.Context, msg *bus.Message) error {
+	select {
+	case b.topic(msg.Topic) <- clone(msg):
+		return nil
+	default:
+		return errors.Errorf("memory topic %s is full", msg.Topic)
+	}
+}
+
+func (b *Bus) Subscribe(ctx context.Context, sub bus.Subscription) error {
+	messages := b.topic(sub.Topic)
+	drain := context.WithoutCancel(ctx)
+	lag := metrics.Lag.WithLabelValues(b.Name(), sub.Topic)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg := <-messages:
+			lag.Set(float64(len(messages)))
+			b.handle(ctx, drain, sub, msg)
+		}
+	}
+}
+
+// handle retries retryable failures with exponential backoff and keeps
+// the message as a dead letter once it is given up on. A shutdown during
+// backoff dead-letters it right away, since nothing would redeliver it.
+func (b *Bus) handle(ctx, drain context.Context, sub bus.Subscription, msg *bus.Message) {
+	var (
+		err     error
+		attempt int
+	)
+
+	for attempt = 1; ; attempt++ {
+		if err = sub.Handler(drain, msg); err == nil {
+			return
+		}
+
+		if !errs.Retryable(err) || attempt > maxRetries || sleep(ctx, retryBackoff<<(attempt-1)) != nil {
+			break
+		}
+	}
+
+	b.mu.Lock()
+	b.deadLetters[sub.Topic] = append(b.deadLetters[sub.Topic], bus.DeadLetter{
+		MessageID:      msg.Headers[dedup.Header],
+		Queue:          sub.Topic,
+		Attempts:       attempt,
+		LastError:      err.Error(),
+		DeadLetteredAt: time.Now().UTC().Format(time.RFC3339),
+		ContentType:    msg.Headers[codec.HeaderContentType],
+		Headers:        headersOf(msg),
+		Body:           string(msg.Payload),
+	})
+	b.mu.Unlock()
+
+	b.logger.Warn("dead-lettered message", "transport", b.Name(), "topic", sub.Topic, "attempts", attempt, "error", err.Error())
+	if sub.OnDeadLetter != nil {
+		sub.OnDeadLetter(drain, msg, err)
+	}
+}
+
+func (b *Bus) DeadLetterQueues() ([]bus.DeadLetterQueue, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var res []bus.DeadLetterQueue
+	for _, topic := range slices.Sorted(maps.Keys(b.deadLetters)) {
+		res = append(res, bus.DeadLetterQueue{Queue: topic, DeadLetter: topic, Messages: len(b.deadLetters[topic])})
+	}
+	return res, nil
+}
+
+func (b *Bus) PeekDeadLetters(topic string, limit int) ([]bus.DeadLetter, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	letters, ok := b.deadLetters[topic]
+	if !ok {
+		return nil, errs.NotFound("unknown queue: " + topic)
+	}
+
+	return slices.Clone(letters[:min(limit, len(letters))]), nil
+}
+
+func (b *Bus) ReplayDeadLetters(topic string, limit int) (int, error) {
+	letters, err := b.PeekDeadLetters(topic, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var replayed int
+	for _, dl := range letters {
+		msg := &bus.Message{Topic: topic, Headers: map[string]string{}, Payload: []byte(dl.Body)}
+		for k, v := range dl.Headers {
+			msg.Headers[k], _ = v.(string)
+		}
+
+		if err := b.Publish(context.Background(), msg); err != nil {
+			break
+		}
+		replayed++
+	}
+
+	// Newer dead letters are appended, so the replayed ones are still first.
+	b.mu.Lock()
+	b.deadLetters[topic] = b.deadLetters[topic][replayed:]
+	b.mu.Unlock()
+
+	return replayed, nil
+}
+
+func (b *Bus) topic(name string) chan *bus.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch, ok := b.topics[name]
+	if !ok {
+		ch = make(chan *bus.Message, topicCapacity)
+		b.topics[name] = ch
+	}
+	return ch
+}
+
+// clone copies msg so that publishers may reuse it.
+func clone(msg *bus.Message) *bus.Message {
+	res := *msg
+	res.Headers = maps.Clone(msg.Headers)
+	res.Payload = slices.Clone(msg.Payload)
+	return &res
+}
+
+func headersOf(msg *bus.Message) map[string]any {
+	headers := make(map[string]any, len(msg.Headers))
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	return headers
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
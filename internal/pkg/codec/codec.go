@@ -0,0 +1,158 @@
+package codec
+
+import (
+	"log/slog"
+	"practice/internal/pkg/config"
+	"practice/internal/pkg/errs"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"go.uber.org/fx"
+)
+
+// Message headers describing the payload. On RabbitMQ the content type
+// travels in the AMQP content-type property instead.
+const (
+	HeaderContentType   = "content-type"
+	HeaderSchema        = "schema"
+	HeaderSchemaVersion = "schema-version"
+)
+
+// Subjects of the async command payloads.
+const (
+	SubjectUser          = "user"
+	SubjectUserPatch     = "user_patch"
+	SubjectComputer      = "computer"
+	SubjectComputerPatch = "computer_patch"
+	SubjectDelete        = "delete"
+)
+
+// Delete is the payload of delete commands. Messages without a schema
+// version predate it and carry the bare id instead. ReassignTo names the
+// user that gets the computers of a deleted user, which are otherwise
+// unassigned.
+type Delete struct {
+	ID         string `json:"id"`
+	ReassignTo string `json:"reassignTo,omitempty"`
+}
+
+// Codec converts values to and from one wire format. Values go through
+// their JSON form, so json tags name the schema fields.
+type Codec interface {
+	ContentType() string
+	Encode(subject string, version int, v any) ([]byte, error)
+	Decode(subject string, version int, data []byte, v any) error
+}
+
+var Module = fx.Provide(New)
+
+type Options struct {
+	fx.In
+	Cfg    *config.Config
+	Logger *slog.Logger
+}
+
+// Codecs encodes outgoing messages with the configured content type and
+// decodes incoming ones with whatever codec their content-type header names.
+type Codecs struct {
+	registry *Registry
+	encoder  Codec
+	codecs   map[string]Codec
+}
+
+func New(opts Options) (*Codecs, error) {
+	registry, err := LoadRegistry(opts.Cfg.SCHEMA_REGISTRY_DIR)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Codecs{
+		registry: registry,
+		codecs:   map[string]Codec{},
+	}
+	for _, codec := range []Codec{JSON{}, &Protobuf{registry: registry}, &Avro{registry: registry}} {
+		c.codecs[codec.ContentType()] = codec
+	}
+
+	encoder, ok := c.codecs[opts.Cfg.MESSAGE_CONTENT_TYPE]
+	if !ok {
+		return nil, errors.Errorf("unsupported message content type %q", opts.Cfg.MESSAGE_CONTENT_TYPE)
+	}
+	c.encoder = encoder
+
+	opts.Logger.Info("message codec selected", "contentType", encoder.ContentType())
+	return c, nil
+}
+
+// Encode serializes v with the latest schema of subject and returns the
+// headers consumers need to decode it.
+func (c *Codecs) Encode(subject string, v any) ([]byte, map[string]string, error) {
+	version := c.registry.Latest(subject)
+
+	data, err := c.encoder.Encode(subject, version, v)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error while encoding %s", subject)
+	}
+
+	return data, map[string]string{
+		HeaderContentType:   c.encoder.ContentType(),
+		HeaderSchema:        subject,
+		HeaderSchemaVersion: strconv.Itoa(version),
+	}, nil
+}
+
+// Decode deserializes data into v using headers. Messages without headers
+// are treated as schemaless JSON. Decoding failures are permanent, so they
+// are reported as validation errors.
+func (c *Codecs) Decode(subject string, headers map[string]string, data []byte, v any) error {
+	codec, version, err := c.lookup(subject, headers)
+	if err != nil {
+		return err
+	}
+
+	if err := codec.Decode(subject, version, data, v); err != nil {
+		return errs.Wrap(errs.KindValidation, err, "error while decoding "+subject)
+	}
+
+	return nil
+}
+
+// DecodeDelete returns the payload of a delete command in either shape.
+func (c *Codecs) DecodeDelete(headers map[string]string, data []byte) (*Delete, error) {
+	if headers[HeaderSchemaVersion] == "" {
+		return &Delete{ID: string(data)}, nil
+	}
+
+	var req Delete
+	if err := c.Decode(SubjectDelete, headers, data, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func (c *Codecs) lookup(subject string, headers map[string]string) (Codec, int, error) {
+	contentType := headers[HeaderContentType]
+	if contentType == "" {
+		contentType = ContentTypeJSON
+	}
+
+	codec, ok := c.codecs[contentType]
+	if !ok {
+		return nil, 0, errs.Validation("unsupported content type: " + contentType)
+	}
+
+	if s := headers[HeaderSchema]; s != "" && s != subject {
+		return nil, 0, errs.Validation("unexpected schema " + s + ", want " + subject)
+	}
+
+	var version int
+	if v := headers[HeaderSchemaVersion]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, 0, errs.Validation("invalid schema version: " + v)
+		}
+		version = n
+	}
+
+	return codec, version, nil
+}
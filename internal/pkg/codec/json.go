@@ -0,0 +1,18 @@
+package codec
+
+import "encoding/json"
+
+const ContentTypeJSON = "application/json"
+
+// JSON is schemaless; the version header only documents the shape.
+type JSON struct{}
+
+func (JSON) ContentType() string { return ContentTypeJSON }
+
+func (JSON) Encode(_ string, _ int, v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSON) Decode(_ string, _ int, data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
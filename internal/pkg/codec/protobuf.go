@@ -0,0 +1,57 @@
+package codec
+
+import (
+	"encoding/json"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const ContentTypeProtobuf = "application/x-protobuf"
+
+// Protobuf encodes with the .proto schemas of the registry through dynamic
+// messages, mapping fields by their JSON names.
+type Protobuf struct {
+	registry *Registry
+}
+
+func (p *Protobuf) ContentType() string { return ContentTypeProtobuf }
+
+func (p *Protobuf) Encode(subject string, version int, v any) ([]byte, error) {
+	desc, err := p.registry.Proto(subject, version)
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := dynamicpb.NewMessage(desc)
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(text, msg); err != nil {
+		return nil, err
+	}
+
+	return proto.Marshal(msg)
+}
+
+func (p *Protobuf) Decode(subject string, version int, data []byte, v any) error {
+	desc, err := p.registry.Proto(subject, version)
+	if err != nil {
+		return err
+	}
+
+	msg := dynamicpb.NewMessage(desc)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return err
+	}
+
+	text, err := protojson.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(text, v)
+}
@@ -0,0 +1,146 @@
+package codec
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/linkedin/goavro/v2"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// schemaFile matches the files of a registry directory:
+//
+//	<dir>/<subject>/v<version>.avsc   Avro schema
+//	<dir>/<subject>/v<version>.proto  Protobuf schema, first message is used
+//
+// Versions only ever get added; consumers decode each message with the
+// version it was written with, so old and new shapes are read side by side.
+var schemaFile = regexp.MustCompile(`^v([1-9][0-9]*)\.(avsc|proto)$`)
+
+type schemaKey struct {
+	subject string
+	version int
+}
+
+// Registry is a schema registry backed by a local directory, loaded once.
+type Registry struct {
+	latest map[string]int
+	avro   map[schemaKey]*goavro.Codec
+	proto  map[schemaKey]protoreflect.MessageDescriptor
+}
+
+// LoadRegistry reads every schema below dir. A missing directory yields an
+// empty registry, which only supports schemaless JSON.
+func LoadRegistry(dir string) (*Registry, error) {
+	r := &Registry{
+		latest: map[string]int{},
+		avro:   map[schemaKey]*goavro.Codec{},
+		proto:  map[schemaKey]protoreflect.MessageDescriptor{},
+	}
+
+	subjects, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error while reading schema registry")
+	}
+
+	for _, subject := range subjects {
+		if !subject.IsDir() {
+			continue
+		}
+
+		files, err := os.ReadDir(filepath.Join(dir, subject.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error while reading schemas of %s", subject.Name())
+		}
+
+		for _, file := range files {
+			m := schemaFile.FindStringSubmatch(file.Name())
+			if m == nil {
+				continue
+			}
+
+			version, _ := strconv.Atoi(m[1])
+			key := schemaKey{subject: subject.Name(), version: version}
+			path := filepath.Join(dir, subject.Name(), file.Name())
+
+			switch m[2] {
+			case "avsc":
+				err = r.loadAvro(key, path)
+			case "proto":
+				err = r.loadProto(key, dir, filepath.Join(subject.Name(), file.Name()))
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			if version > r.latest[key.subject] {
+				r.latest[key.subject] = version
+			}
+		}
+	}
+
+	return r, nil
+}
+
+func (r *Registry) loadAvro(key schemaKey, path string) error {
+	schema, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "error while reading %s", path)
+	}
+
+	codec, err := goavro.NewCodec(string(schema))
+	if err != nil {
+		return errors.Wrapf(err, "error while parsing %s", path)
+	}
+
+	r.avro[key] = codec
+	return nil
+}
+
+func (r *Registry) loadProto(key schemaKey, dir, path string) error {
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: []string{dir}}),
+	}
+
+	files, err := compiler.Compile(context.Background(), path)
+	if err != nil {
+		return errors.Wrapf(err, "error while compiling %s", path)
+	}
+
+	messages := files[0].Messages()
+	if messages.Len() == 0 {
+		return errors.Errorf("%s declares no message", path)
+	}
+
+	r.proto[key] = messages.Get(0)
+	return nil
+}
+
+// Latest returns the newest version of subject, or 0 if it has no schema.
+func (r *Registry) Latest(subject string) int {
+	return r.latest[subject]
+}
+
+func (r *Registry) Avro(subject string, version int) (*goavro.Codec, error) {
+	codec, ok := r.avro[schemaKey{subject: subject, version: version}]
+	if !ok {
+		return nil, errors.Errorf("no avro schema for %s v%d", subject, version)
+	}
+	return codec, nil
+}
+
+func (r *Registry) Proto(subject string, version int) (protoreflect.MessageDescriptor, error) {
+	desc, ok := r.proto[schemaKey{subject: subject, version: version}]
+	if !ok {
+		return nil, errors.Errorf("no protobuf schema for %s v%d", subject, version)
+	}
+	return desc, nil
+}
@@ -0,0 +1,63 @@
+package command
+
+import (
+	"context"
+	"practice/internal/pkg/dedup"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+// Command tracks an async request from acceptance to its outcome. Its id
+// is the message id of the broker message that carries it.
+type Command struct {
+	ID        string    `json:"id" bson:"_id"`
+	Type      string    `json:"type" bson:"type"`
+	Status    Status    `json:"status" bson:"status"`
+	EntityID  string    `json:"entityId,omitempty" bson:"entityId"`
+	Error     string    `json:"error,omitempty" bson:"error"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
+// Store is implemented by the command table or collection of every
+// database that owns aggregates. Add and Succeed must join the transaction
+// carried by ctx.
+type Store interface {
+	// Add records cmd as pending.
+	Add(ctx context.Context, cmd *Command) error
+	// Get returns an errs.NotFound error for unknown ids.
+	Get(ctx context.Context, id string) (*Command, error)
+	// Succeed marks the command succeeded, creating it if it was sent by
+	// another producer.
+	Succeed(ctx context.Context, id, entityID string) error
+	// Fail marks the command failed unless it has already succeeded.
+	Fail(ctx context.Context, id, cause string) error
+}
+
+// Complete marks the command carried by ctx as succeeded with entityID.
+// It must be called in the transaction that applied the command, so the
+// status only changes if the change commits. Requests without a message
+// id, such as synchronous HTTP calls, are not tracked.
+func Complete(ctx context.Context, store Store, entityID string) error {
+	id := dedup.MessageID(ctx)
+	if id == "" {
+		return nil
+	}
+	return store.Succeed(ctx, id, entityID)
+}
+
+// Fail marks the command carried by ctx as failed with cause.
+func Fail(ctx context.Context, store Store, cause error) error {
+	id := dedup.MessageID(ctx)
+	if id == "" {
+		return nil
+	}
+	return store.Fail(ctx, id, cause.Error())
+}
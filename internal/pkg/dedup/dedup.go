@@ -0,0 +1,48 @@
+package dedup
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// Header names the broker header, or AMQP message-id property, that carries
+// the id of an async command.
+const Header = "message-id"
+
+// ErrDuplicate is returned when a message id has already been recorded.
+// Consumers treat it as success, so redelivery is a no-op.
+var ErrDuplicate = errors.New("message already processed")
+
+// Store records processed message ids. Add must join the transaction
+// carried by ctx, so the id is only kept if the side effect is committed.
+type Store interface {
+	Add(ctx context.Context, id string) error
+}
+
+type messageIDKey struct{}
+
+// WithMessageID returns a copy of ctx carrying the id of the message being
+// handled.
+func WithMessageID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, messageIDKey{}, id)
+}
+
+// MessageID returns the message id carried by ctx, if any.
+func MessageID(ctx context.Context) string {
+	id, _ := ctx.Value(messageIDKey{}).(string)
+	return id
+}
+
+// Record marks the message carried by ctx as processed in store. Requests
+// without a message id, such as synchronous HTTP calls, are not tracked.
+func Record(ctx context.Context, store Store) error {
+	id := MessageID(ctx)
+	if id == "" {
+		return nil
+	}
+	return store.Add(ctx, id)
+}
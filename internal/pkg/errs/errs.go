@@ -0,0 +1,140 @@
+package errs
+
+import "errors"
+
+// Kind classifies an error so that transports can react to it without
+// knowing which store or service produced it.
+type Kind uint8
+
+const (
+	KindInternal Kind = iota
+	KindNotFound
+	KindValidation
+	KindConflict
+	KindAlreadyDeleted
+	KindNotModified
+	KindPreconditionFailed
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindNotFound:
+		return "not found"
+	case KindValidation:
+		return "validation"
+	case KindConflict:
+		return "conflict"
+	case KindAlreadyDeleted:
+		return "already deleted"
+	case KindNotModified:
+		return "not modified"
+	case KindPreconditionFailed:
+		return "precondition failed"
+	}
+	return "internal"
+}
+
+// FieldError describes why a single input field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type Error struct {
+	Kind    Kind
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func New(kind Kind, msg string) error {
+	return &Error{Kind: kind, Message: msg}
+}
+
+func Wrap(kind Kind, err error, msg string) error {
+	return &Error{Kind: kind, Message: msg, Err: err}
+}
+
+func NotFound(msg string) error {
+	return New(KindNotFound, msg)
+}
+
+func Validation(msg string) error {
+	return New(KindValidation, msg)
+}
+
+// Invalid returns a validation error carrying per-field reasons.
+func Invalid(msg string, fields ...FieldError) error {
+	return &Error{Kind: KindValidation, Message: msg, Fields: fields}
+}
+
+func Conflict(msg string) error {
+	return New(KindConflict, msg)
+}
+
+func AlreadyDeleted(msg string) error {
+	return New(KindAlreadyDeleted, msg)
+}
+
+func NotModified(msg string) error {
+	return New(KindNotModified, msg)
+}
+
+// PreconditionFailed reports a write that expected another version of the
+// entity than the stored one.
+func PreconditionFailed(msg string) error {
+	return New(KindPreconditionFailed, msg)
+}
+
+// KindOf returns the kind of the first *Error in err's chain, or
+// KindInternal when there is none.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return KindInternal
+}
+
+// MessageOf returns the message of the first *Error in err's chain, without
+// the errors it wraps, or "" when there is none.
+func MessageOf(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Message
+	}
+	return ""
+}
+
+// FieldsOf returns the field errors attached to err, if any.
+func FieldsOf(err error) []FieldError {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Fields
+	}
+	return nil
+}
+
+func Is(err error, kind Kind) bool {
+	return err != nil && KindOf(err) == kind
+}
+
+// Retryable reports whether retrying the failed operation may succeed.
+// Classified errors describe the request itself and are permanent, except
+// for version mismatches: a command may arrive before the change it was
+// based on, and succeed once that one is applied.
+func Retryable(err error) bool {
+	kind := KindOf(err)
+	return kind == KindInternal || kind == KindPreconditionFailed
+}
@@ -0,0 +1,76 @@
+package event
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// SchemaVersion is the version of the envelope and payload layout. Bump it
+// on breaking payload changes so subscribers can tell shapes apart.
+// Version 2 moved it out of Envelope.Version, now the aggregate's version.
+const SchemaVersion = 2
+
+type Type string
+
+const (
+	UserCreated      Type = "UserCreated"
+	UserUpdated      Type = "UserUpdated"
+	UserDeleted      Type = "UserDeleted"
+	UserRestored     Type = "UserRestored"
+	UserPurged       Type = "UserPurged"
+	ComputerCreated  Type = "ComputerCreated"
+	ComputerUpdated  Type = "ComputerUpdated"
+	ComputerDeleted  Type = "ComputerDeleted"
+	ComputerRestored Type = "ComputerRestored"
+	ComputerPurged   Type = "ComputerPurged"
+)
+
+// RoutingKey turns UserCreated into user.created.
+func (t Type) RoutingKey() string {
+	s := string(t)
+	for i := 1; i < len(s); i++ {
+		if s[i] >= 'A' && s[i] <= 'Z' {
+			return strings.ToLower(s[:i] + "." + s[i:])
+		}
+	}
+	return strings.ToLower(s)
+}
+
+// Envelope is the outbound representation of a domain event. Version is
+// the version of the aggregate the event leaves, so subscribers can order
+// and deduplicate the events of each aggregate.
+type Envelope struct {
+	ID            string          `json:"id"`
+	Type          Type            `json:"type"`
+	Timestamp     time.Time       `json:"timestamp"`
+	AggregateID   string          `json:"aggregateId"`
+	Version       int             `json:"version"`
+	SchemaVersion int             `json:"schemaVersion"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+// Deleted is the payload of the *Deleted events.
+type Deleted struct {
+	ID string `json:"id"`
+}
+
+func New(typ Type, aggregateID string, version int, payload any) (*Envelope, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "error while encoding event payload")
+	}
+
+	return &Envelope{
+		ID:            uuid.NewString(),
+		Type:          typ,
+		Timestamp:     time.Now().UTC(),
+		AggregateID:   aggregateID,
+		Version:       version,
+		SchemaVersion: SchemaVersion,
+		Payload:       data,
+	}, nil
+}
@@ -0,0 +1,100 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"practice/internal/pkg/bus"
+	"practice/internal/pkg/config"
+	"practice/internal/pkg/dedup"
+	"practice/internal/pkg/outbox"
+
+	"github.com/pkg/errors"
+)
+
+// Destination is a topic, or a RabbitMQ exchange, that events are sent to
+// on the bus named by Transport.
+type Destination struct {
+	Transport string
+	Topic     string
+}
+
+// Destinations lists where the events of an aggregate go on the buses
+// enabled by BUS_TRANSPORTS: kafkaTopic on Kafka and the in-memory bus, the
+// events exchange on RabbitMQ and subjects under the events prefix on NATS.
+// Empty names are skipped.
+func Destinations(cfg *config.Config, kafkaTopic string) []Destination {
+	var res []Destination
+	for _, transport := range cfg.BUS_TRANSPORTS {
+		topic := kafkaTopic
+		switch transport {
+		case outbox.TransportRabbitMQ:
+			topic = cfg.RabbitMQ_EXCHANGE_EVENTS
+		case outbox.TransportNATS:
+			topic = cfg.NATS_SUBJECT_EVENTS
+		}
+		if topic != "" {
+			res = append(res, Destination{Transport: transport, Topic: topic})
+		}
+	}
+	return res
+}
+
+// Publisher records events in an outbox store, once per destination.
+type Publisher struct {
+	store        outbox.Store
+	destinations []Destination
+}
+
+func NewPublisher(store outbox.Store, destinations []Destination) *Publisher {
+	return &Publisher{
+		store:        store,
+		destinations: destinations,
+	}
+}
+
+// Publish must be called with the ctx of the transaction that changed the
+// aggregate to version, so the event is stored if and only if the change
+// commits.
+func (p *Publisher) Publish(ctx context.Context, typ Type, aggregateID string, version int, payload any) error {
+	e, err := New(typ, aggregateID, version, payload)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "error while encoding event")
+	}
+
+	headers := map[string]string{
+		"event-type": string(typ),
+		dedup.Header: e.ID,
+	}
+	if id := bus.CorrelationID(ctx); id != "" {
+		headers[bus.HeaderCorrelationID] = id
+	}
+
+	for _, d := range p.destinations {
+		// Kafka partitions by aggregate to keep its events in order;
+		// RabbitMQ routes by event type and NATS by subject.
+		topic, key := d.Topic, aggregateID
+		switch d.Transport {
+		case outbox.TransportRabbitMQ:
+			key = typ.RoutingKey()
+		case outbox.TransportNATS:
+			topic += "." + typ.RoutingKey()
+		}
+
+		if err := p.store.Add(ctx, &outbox.Message{
+			Transport: d.Transport,
+			Topic:     topic,
+			Key:       key,
+			Headers:   headers,
+			Payload:   body,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
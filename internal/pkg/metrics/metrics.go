@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Message consumption, labelled by bus and topic (or queue), served on
+// /metrics.
+var (
+	InFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "practice",
+		Subsystem: "bus",
+		Name:      "messages_in_flight",
+		Help:      "Messages being handled.",
+	}, []string{"transport", "topic"})
+
+	Handled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "practice",
+		Subsystem: "bus",
+		Name:      "messages_handled_total",
+		Help:      "Handler calls by outcome: ok, duplicate or error.",
+	}, []string{"transport", "topic", "outcome"})
+
+	HandleDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "practice",
+		Subsystem: "bus",
+		Name:      "message_handle_seconds",
+		Help:      "Time spent in handlers.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"transport", "topic"})
+
+	Lag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "practice",
+		Subsystem: "bus",
+		Name:      "consumer_lag",
+		Help:      "Messages waiting to be delivered: unread offsets on Kafka, ready messages on RabbitMQ, pending messages on NATS and the memory bus.",
+	}, []string{"transport", "topic"})
+)
@@ -1,6 +1,9 @@
 package pkg
 
 import (
+	"practice/internal/pkg/bus"
+	"practice/internal/pkg/bus/memory"
+	"practice/internal/pkg/codec"
 	"practice/internal/pkg/config"
 	"practice/internal/pkg/logger"
 
@@ -10,4 +13,7 @@ import (
 var Module = fx.Options(
 	config.Module,
 	logger.Module,
+	codec.Module,
+	bus.Module,
+	memory.Module,
 )
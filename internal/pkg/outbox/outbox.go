@@ -0,0 +1,49 @@
+package outbox
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	TransportKafka    = "kafka"
+	TransportRabbitMQ = "rabbitmq"
+	TransportNATS     = "nats"
+	TransportMemory   = "memory"
+)
+
+// Message is a broker publication recorded next to the change that caused
+// it and delivered later by the relay through the bus named by Transport.
+// Topic and Key mean what they mean for that bus: the topic and message key
+// for Kafka, the exchange and routing key for RabbitMQ, or a command queue
+// whose routing the topology knows, and the subject for NATS, which has no
+// keys. Rows written before the bus existed may target a RabbitMQ queue
+// directly, with an empty Topic and the queue name as Key.
+type Message struct {
+	ID            string            `json:"id" bson:"_id"`
+	Transport     string            `json:"transport" bson:"transport"`
+	Topic         string            `json:"topic" bson:"topic"`
+	Key           string            `json:"key" bson:"key"`
+	Headers       map[string]string `json:"headers" bson:"headers"`
+	Payload       []byte            `json:"payload" bson:"payload"`
+	Attempts      int               `json:"attempts" bson:"attempts"`
+	LastError     string            `json:"lastError" bson:"lastError"`
+	CreatedAt     time.Time         `json:"createdAt" bson:"createdAt"`
+	NextAttemptAt time.Time         `json:"nextAttemptAt" bson:"nextAttemptAt"`
+	SentAt        *time.Time        `json:"sentAt" bson:"sentAt"`
+}
+
+// Store is implemented by every outbox table or collection. Add must join
+// the transaction carried by ctx, so a message is kept if and only if the
+// change that caused it commits.
+type Store interface {
+	Add(ctx context.Context, msg *Message) error
+	// Claim leases up to limit due messages with fewer than maxAttempts
+	// attempts, hiding them from other relays until lease expires.
+	Claim(ctx context.Context, limit, maxAttempts int, lease time.Duration) ([]*Message, error)
+	MarkSent(ctx context.Context, id string) error
+	MarkFailed(ctx context.Context, id string, cause string, retryAt time.Time) error
+	// PurgeSent removes up to limit messages sent before before and returns
+	// how many it removed.
+	PurgeSent(ctx context.Context, before time.Time, limit int) (int, error)
+}
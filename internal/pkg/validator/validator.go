@@ -0,0 +1,187 @@
+package validator
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"practice/internal/pkg/errs"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Struct checks the `validate` tags of v, which must be a struct or a
+// pointer to one, and returns an errs validation error listing every
+// violated field by its JSON name. Supported rules:
+//
+//	required      the field is not its zero value (strings are trimmed)
+//	min=N, max=N  string length in characters or numeric value bounds
+//	email         a bare RFC 5322 address, without display name
+//	ip            an IPv4 or IPv6 address
+//	uuid          a UUID in canonical form: lower-case and hyphenated
+//	oneof=a b c   one of the listed values, spelled exactly as listed
+//
+// Rules other than required are skipped for empty values.
+func Struct(v any) error {
+	val := reflect.ValueOf(v)
+	if val.Kind() == reflect.Pointer {
+		if val.IsNil() {
+			return errs.Validation("value is nil")
+		}
+		val = val.Elem()
+	}
+
+	if val.Kind() != reflect.Struct {
+		return errs.Validation("value is not a struct")
+	}
+
+	var fields []errs.FieldError
+
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		tag := sf.Tag.Get("validate")
+		if tag == "" || tag == "-" {
+			continue
+		}
+
+		if msg := check(val.Field(i), tag); msg != "" {
+			fields = append(fields, errs.FieldError{Field: fieldName(sf), Message: msg})
+		}
+	}
+
+	if len(fields) > 0 {
+		return errs.Invalid("validation failed", fields...)
+	}
+
+	return nil
+}
+
+func check(field reflect.Value, tag string) string {
+	for field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			if hasRule(tag, "required") {
+				return "is required"
+			}
+			return ""
+		}
+		field = field.Elem()
+	}
+
+	empty := isEmpty(field)
+
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+
+		if name == "required" {
+			if empty {
+				return "is required"
+			}
+			continue
+		}
+
+		if empty {
+			continue
+		}
+
+		if msg := apply(field, name, arg); msg != "" {
+			return msg
+		}
+	}
+
+	return ""
+}
+
+func apply(field reflect.Value, rule, arg string) string {
+	switch rule {
+	case "min", "max":
+		limit, err := strconv.Atoi(arg)
+		if err != nil {
+			panic(fmt.Sprintf("validator: bad %s argument %q", rule, arg))
+		}
+
+		n, unit := size(field)
+		if rule == "min" && n < limit {
+			return fmt.Sprintf("must be at least %d%s", limit, unit)
+		}
+		if rule == "max" && n > limit {
+			return fmt.Sprintf("must be at most %d%s", limit, unit)
+		}
+
+	case "email":
+		s := field.String()
+		addr, err := mail.ParseAddress(s)
+		if err != nil || addr.Address != s || !strings.Contains(s[strings.LastIndex(s, "@"):], ".") {
+			return "must be a valid email address"
+		}
+
+	case "ip":
+		if net.ParseIP(field.String()) == nil {
+			return "must be a valid IPv4 or IPv6 address"
+		}
+
+	case "uuid":
+		// Parse also accepts braced, URN and unhyphenated forms, which
+		// would not match ids stored in canonical form.
+		s := field.String()
+		if u, err := uuid.Parse(s); err != nil || u.String() != s {
+			return "must be a valid UUID in canonical form"
+		}
+
+	case "oneof":
+		s := field.String()
+		allowed := strings.Fields(arg)
+		for _, a := range allowed {
+			if s == a {
+				return ""
+			}
+		}
+		return "must be one of: " + strings.Join(allowed, ", ")
+
+	default:
+		panic(fmt.Sprintf("validator: unknown rule %q", rule))
+	}
+
+	return ""
+}
+
+func size(field reflect.Value) (int, string) {
+	switch field.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(field.String()), " characters"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(field.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(field.Uint()), ""
+	case reflect.Slice, reflect.Map:
+		return field.Len(), " items"
+	}
+	panic(fmt.Sprintf("validator: min/max on unsupported kind %s", field.Kind()))
+}
+
+func isEmpty(field reflect.Value) bool {
+	if field.Kind() == reflect.String {
+		return strings.TrimSpace(field.String()) == ""
+	}
+	return field.IsZero()
+}
+
+func hasRule(tag, name string) bool {
+	for _, rule := range strings.Split(tag, ",") {
+		if rule == name {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+	return name
+}
@@ -0,0 +1,65 @@
+package connection
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ConfirmChannel is a channel in confirm mode with the returns of its
+// mandatory publishes. It carries one publish at a time, so a return
+// received before the confirm belongs to that publish.
+type ConfirmChannel struct {
+	*amqp.Channel
+	returns chan amqp.Return
+}
+
+// ConfirmChannel opens a channel in confirm mode on the current connection,
+// failing right away with ErrNotConnected while it is down.
+func (c *Connection) ConfirmChannel() (*ConfirmChannel, error) {
+	ch, err := c.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, errors.Wrap(err, "error while enabling publisher confirms")
+	}
+
+	return &ConfirmChannel{
+		Channel: ch,
+		// Returns are delivered by the connection's reader, which blocks
+		// until they are received, so there is room for the one publish
+		// in flight.
+		returns: ch.NotifyReturn(make(chan amqp.Return, 1)),
+	}, nil
+}
+
+// PublishConfirmed returns once the broker confirms it has taken
+// responsibility for publishing, failing if it is nacked, not confirmed
+// before ctx is done or, when mandatory, returned because no queue is bound
+// for it. Callers must not publish on ch concurrently.
+func (ch *ConfirmChannel) PublishConfirmed(ctx context.Context, exchange, routingKey string, mandatory bool, publishing amqp.Publishing) error {
+	confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, exchange, routingKey, mandatory, false, publishing)
+	if err != nil {
+		return errors.Wrapf(err, "error while publishing to %s", exchange)
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "error while waiting for confirm from %s", exchange)
+	}
+	if !acked {
+		return errors.Errorf("message nacked by %s", exchange)
+	}
+
+	// The broker sends a return before the confirm of the same message.
+	select {
+	case ret := <-ch.returns:
+		return errors.Errorf("message returned by %s with key %q: %s", exchange, routingKey, ret.ReplyText)
+	default:
+		return nil
+	}
+}
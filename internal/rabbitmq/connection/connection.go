@@ -0,0 +1,163 @@
+package connection
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var (
+	ErrNotConnected = errors.New("rabbitmq is not connected")
+	ErrClosed       = errors.New("rabbitmq connection is closed")
+)
+
+type Config struct {
+	// Name identifies the connection in logs.
+	Name       string
+	Address    string
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// Connection keeps an AMQP connection open. It dials in the background and,
+// whenever the broker closes the connection, redials with exponential
+// backoff. Channels opened on a lost connection are closed with it, so
+// users open new ones once Wait returns.
+type Connection struct {
+	cfg    Config
+	logger *slog.Logger
+
+	mu         sync.Mutex
+	conn       *amqp.Connection
+	ready      chan struct{}
+	generation uint64
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func New(cfg Config, logger *slog.Logger) *Connection {
+	c := &Connection{
+		cfg:    cfg,
+		logger: logger,
+		ready:  make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	c.wg.Add(1)
+	go c.run()
+
+	return c
+}
+
+func (c *Connection) run() {
+	defer c.wg.Done()
+
+	for attempt := 0; ; attempt++ {
+		conn, err := amqp.Dial(c.cfg.Address)
+		if err != nil {
+			delay := c.Backoff(attempt)
+			c.logger.Error("error connecting rabbitmq, retrying",
+				"connection", c.cfg.Name, "retryIn", delay, "error", err.Error())
+
+			select {
+			case <-c.done:
+				return
+			case <-time.After(delay):
+				continue
+			}
+		}
+
+		attempt = -1
+		closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+
+		c.mu.Lock()
+		c.conn = conn
+		c.generation++
+		close(c.ready)
+		c.mu.Unlock()
+
+		c.logger.Info("rabbitmq connected", "connection", c.cfg.Name)
+
+		select {
+		case <-c.done:
+			conn.Close()
+			return
+		case err := <-closed:
+			c.mu.Lock()
+			c.conn = nil
+			c.ready = make(chan struct{})
+			c.mu.Unlock()
+
+			reason := "closed"
+			if err != nil {
+				reason = err.Error()
+			}
+			c.logger.Warn("rabbitmq connection lost, reconnecting", "connection", c.cfg.Name, "reason", reason)
+		}
+	}
+}
+
+// Wait blocks until the connection is up, ctx is done or Close is called.
+func (c *Connection) Wait(ctx context.Context) error {
+	c.mu.Lock()
+	ready := c.ready
+	c.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.done:
+		return ErrClosed
+	}
+}
+
+// Channel opens a channel on the current connection, failing right away
+// with ErrNotConnected while it is down.
+func (c *Connection) Channel() (*amqp.Channel, error) {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+
+	if conn == nil {
+		return nil, ErrNotConnected
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, errors.Wrap(err, "error while opening channel")
+	}
+	return ch, nil
+}
+
+// Generation counts successful connects, so state tied to a connection,
+// such as declared topology, can tell when it has to be redone.
+func (c *Connection) Generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generation
+}
+
+// Close stops reconnecting and closes the current connection, if any.
+func (c *Connection) Close() error {
+	close(c.done)
+	c.wg.Wait()
+	return nil
+}
+
+// Backoff is the delay before retry attempt (counted from 0) of anything
+// failing along with the connection.
+func (c *Connection) Backoff(attempt int) time.Duration {
+	d := c.cfg.Backoff << attempt
+	if d <= 0 || d > c.cfg.MaxBackoff {
+		return c.cfg.MaxBackoff
+	}
+	return d
+}
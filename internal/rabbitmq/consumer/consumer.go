@@ -2,223 +2,228 @@ package consumer
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"log"
 	"log/slog"
+	"practice/internal/pkg/bus"
+	"practice/internal/pkg/codec"
 	"practice/internal/pkg/config"
-	compRepo "practice/internal/repository/mongodb/computer"
-	userRepo "practice/internal/repository/postgres/user"
-	"practice/internal/service/computer"
-	"practice/internal/service/user"
+	"practice/internal/pkg/dedup"
+	"practice/internal/pkg/metrics"
+	"practice/internal/pkg/outbox"
+	"practice/internal/rabbitmq/connection"
+	"practice/internal/rabbitmq/topology"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	amqp "github.com/rabbitmq/amqp091-go"
-	"go.uber.org/fx"
 )
 
-var Module = fx.Provide(New)
+// lagInterval is how often the depth of consumed queues is sampled.
+const lagInterval = 15 * time.Second
 
-type Options struct {
-	fx.In
-	fx.Lifecycle
-	UserService     user.ServiceUser
-	ComputerService computer.ServiceComputer
-	Logger          *slog.Logger
-	Cfg             *config.Config
+// channel is a consumer channel shared by the workers of a queue. Their
+// republishes are serialized, each waiting for its confirm, as the
+// channel carries one publish at a time.
+type channel struct {
+	*connection.ConfirmChannel
+	mu sync.Mutex
 }
 
 type MsgBroker struct {
-	user           user.ServiceUser
-	computer       computer.ServiceComputer
-	channel        *amqp.Channel
-	logger         *slog.Logger
-	cfg            *config.Config
-	wg             *sync.WaitGroup
-	numOfServices  int
-	createUser     <-chan amqp.Delivery
-	updateUser     <-chan amqp.Delivery
-	deleteUser     <-chan amqp.Delivery
-	createComputer <-chan amqp.Delivery
-	updateComputer <-chan amqp.Delivery
-	deleteComputer <-chan amqp.Delivery
+	conn     *connection.Connection
+	topology *topology.Topology
+	logger   *slog.Logger
+	cfg      *config.Config
+	mu       sync.Mutex
+	queues   map[string]bool
 }
 
-func NewChannel(cfg *config.Config) (*amqp.Channel, error) {
-	conn, err := amqp.Dial(cfg.RabbitMQ_ADDRESS)
-	if err != nil {
-		return nil, err
+func New(conn *connection.Connection, topo *topology.Topology, cfg *config.Config, logger *slog.Logger) *MsgBroker {
+	return &MsgBroker{
+		conn:     conn,
+		topology: topo,
+		logger:   logger,
+		cfg:      cfg,
+		queues:   map[string]bool{},
 	}
+}
 
-	channel, err := conn.Channel()
-	if err != nil {
-		return nil, err
-	}
+// Consume declares the topology, which must bind the work queue sub.Topic,
+// and the queue's retry queues and dead letters, and delivers its
+// messages on a dedicated channel until ctx is cancelled. When the channel
+// or connection is lost, it waits for the connection to recover and then
+// declares and consumes again. Deliveries not yet acked when a channel
+// closes are requeued by the broker.
+func (m *MsgBroker) Consume(ctx context.Context, sub bus.Subscription) error {
+	for attempt := 0; ; attempt++ {
+		if err := m.conn.Wait(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
 
-	return channel, nil
+		consumed, err := m.consume(ctx, sub)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if consumed {
+			attempt = 0
+		}
+
+		delay := m.conn.Backoff(attempt)
+		m.logger.Warn("rabbitmq consumer interrupted, resubscribing",
+			"queue", sub.Topic, "retryIn", delay, "error", err.Error())
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+	}
 }
 
-func New(opts Options) *MsgBroker {
-	ch, err := NewChannel(opts.Cfg)
+// consume runs one subscription on a fresh channel until ctx is cancelled
+// or the channel closes, reporting whether it got as far as consuming. Up
+// to the queue's concurrency of messages are handled at once; the prefetch
+// count bounds how many more the broker hands out before they are acked.
+func (m *MsgBroker) consume(ctx context.Context, sub bus.Subscription) (bool, error) {
+	confirmCh, err := m.conn.ConfirmChannel()
 	if err != nil {
-		opts.Logger.Error("error initializing amqp channel", err.Error())
-		return nil
+		return false, err
 	}
+	defer confirmCh.Close()
+
+	ch := &channel{ConfirmChannel: confirmCh}
 
-	msgBroker := &MsgBroker{
-		user:          opts.UserService,
-		computer:      opts.ComputerService,
-		channel:       ch,
-		logger:        opts.Logger,
-		cfg:           opts.Cfg,
-		wg:            &sync.WaitGroup{},
-		numOfServices: 6,
+	if err := m.declareQueue(ch.Channel, sub.Topic); err != nil {
+		return false, err
 	}
 
-	if err := declareQueues(msgBroker); err != nil {
-		msgBroker.logger.Error("error declaring queues: %s", err.Error())
-		return nil
+	concurrency := m.concurrency(sub.Topic)
+	if err := ch.Qos(max(m.cfg.RabbitMQ_PREFETCH, concurrency), 0, false); err != nil {
+		return false, errors.Wrapf(err, "error while setting prefetch of %s", sub.Topic)
 	}
 
-	msgBroker.wg.Add(msgBroker.numOfServices)
-	opts.Lifecycle.Append(fx.Hook{
-		OnStart: func(ctx context.Context) error {
-			go msgBroker.consumeMessages(ctx, msgBroker.createUser, "create_user")
-			go msgBroker.consumeMessages(ctx, msgBroker.updateUser, "update_user")
-			go msgBroker.consumeMessages(ctx, msgBroker.deleteUser, "delete_user")
-			go msgBroker.consumeMessages(ctx, msgBroker.createComputer, "create_computer")
-			go msgBroker.consumeMessages(ctx, msgBroker.updateComputer, "update_computer")
-			go msgBroker.consumeMessages(ctx, msgBroker.deleteComputer, "delete_computer")
+	deliveries, err := ch.Consume(sub.Topic, "", false, false, false, false, nil)
+	if err != nil {
+		return false, errors.Wrapf(err, "error while consuming %s", sub.Topic)
+	}
 
-			log.Println("RabbitMQ consuming")
-			return nil
-		},
-		OnStop: func(ctx context.Context) error {
-			msgBroker.wg.Wait()
-			return msgBroker.channel.Close()
-		},
-	})
-
-	return msgBroker
+	done := make(chan struct{})
+	defer close(done)
+	go m.watchLag(ch.Channel, sub.Topic, done)
+
+	drain := context.WithoutCancel(ctx)
+
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case msg, ok := <-deliveries:
+					if !ok {
+						return
+					}
+
+					if err := sub.Handler(drain, messageOf(sub.Topic, msg)); err != nil {
+						m.retryOrDeadLetter(drain, ch, sub, msg, err)
+						continue
+					}
+					msg.Ack(false)
+
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return true, nil
+	}
+	return true, errors.Errorf("delivery channel of %s closed", sub.Topic)
+}
+
+func (m *MsgBroker) concurrency(queue string) int {
+	if n, ok := m.cfg.RabbitMQ_QUEUE_CONCURRENCY[queue]; ok {
+		return max(n, 1)
+	}
+	return max(m.cfg.RabbitMQ_CONCURRENCY, 1)
 }
 
-func (m *MsgBroker) consumeMessages(ctx context.Context, messages <-chan amqp.Delivery, logPrefix string) {
-	defer m.wg.Done()
-	log.Printf("Consuming %s queue", logPrefix)
-	
+// watchLag reports the ready messages of queue every lagInterval until done.
+func (m *MsgBroker) watchLag(ch *amqp.Channel, queue string, done <-chan struct{}) {
+	lag := metrics.Lag.WithLabelValues(outbox.TransportRabbitMQ, queue)
+
+	ticker := time.NewTicker(lagInterval)
+	defer ticker.Stop()
+
 	for {
-		select {
-		case msg := <-messages:
-			log.Printf("Received data through RabbitMQ: %s", msg.Body)
-			if err := m.processMessage(ctx, logPrefix, msg); err != nil {
-				handleError(m, msg, logPrefix, err, "processing message")
-				msg.Nack(false, false)
-				continue
-			}
-			msg.Ack(false)
+		if q, err := ch.QueueDeclarePassive(queue, true, false, false, false, nil); err == nil {
+			lag.Set(float64(q.Messages))
+		}
 
-		case <-ctx.Done():
-			log.Printf("context done, stopping %s\n", logPrefix)
+		select {
+		case <-done:
 			return
+		case <-ticker.C:
 		}
 	}
 }
 
-func (m *MsgBroker) processMessage(ctx context.Context, logPrefix string, val amqp.Delivery) error {
-	var err error
-
-	switch logPrefix {
-	case "create_user":
-		var req userRepo.User
-		err = json.Unmarshal(val.Body, &req)
-		if err == nil {
-			resp, err2 := m.user.Create(ctx, &req)
-			m.logger.Info("created user: %v", resp)
-			err = err2
-		}
-	case "update_user":
-		var req userRepo.User
-		err = json.Unmarshal(val.Body, &req)
-		if err == nil {
-			resp, err2 := m.user.Update(ctx, &req)
-			m.logger.Info("updated user: %v", resp)
-			err = err2
-		}
-	case "delete_user":
-		if err == nil {
-			resp, err2 := m.user.Delete(ctx, string(val.Body))
-			m.logger.Info("deleted user: %v", resp)
-			err = err2
-		}
-	case "create_computer":
-		var req compRepo.Computer
-		err = json.Unmarshal(val.Body, &req)
-		if err == nil {
-			resp, err2 := m.computer.Create(ctx, &req)
-			m.logger.Info("created computer: %v", resp)
-			err = err2
-		}
-	case "update_computer":
-		var req compRepo.Computer
-		err = json.Unmarshal(val.Body, &req)
-		if err == nil {
-			resp, err2 := m.computer.Update(ctx, &req)
-			m.logger.Info("updated computer: %v", resp)
-			err = err2
-		}
-	case "delete_computer":
-		if err == nil {
-			resp, err2 := m.computer.Delete(ctx, string(val.Body))
-			m.logger.Info("deleted computer: %v", resp)
-			err = err2
-		}
-	default:
-		return errors.Errorf("unknown log prefix: %s", logPrefix)
+func (m *MsgBroker) declareQueue(ch *amqp.Channel, queue string) error {
+	if !m.topology.HasQueue(queue) {
+		return errors.Errorf("queue %s is not bound in the topology", queue)
 	}
 
-	if err != nil {
-		return errors.Errorf("error unmarshalling or processing: ", err)
+	if err := m.topology.Declare(ch); err != nil {
+		return err
 	}
-	return nil
-}
 
-func declareQueues(m *MsgBroker) error {
-	queueNames := []string{
-		m.cfg.RabbitMQ_QUEUE_USER_CREATED,
-		m.cfg.RabbitMQ_QUEUE_USER_UPDATED,
-		m.cfg.RabbitMQ_QUEUE_USER_DELETED,
-		m.cfg.RabbitMQ_QUEUE_COMPUTER_CREATED,
-		m.cfg.RabbitMQ_QUEUE_COMPUTER_UPDATED,
-		m.cfg.RabbitMQ_QUEUE_COMPUTER_DELETED,
+	if err := m.declareDeadLetters(ch, queue); err != nil {
+		return err
 	}
 
-	var consumers []<-chan amqp.Delivery
+	m.mu.Lock()
+	m.queues[queue] = true
+	m.mu.Unlock()
 
-	for _, name := range queueNames {
-		q, err := m.channel.QueueDeclare(name, true, false, false, false, nil)
-		if err != nil {
-			return err
-		}
+	return nil
+}
 
-		con, err := m.channel.Consume(q.Name, "", false, false, false, false, nil)
-		if err != nil {
-			return err
+// messageOf turns a delivery into a bus message, moving the AMQP message
+// id, correlation id and content type back into the headers they were
+// published from.
+func messageOf(queue string, msg amqp.Delivery) *bus.Message {
+	headers := map[string]string{}
+	for k, v := range msg.Headers {
+		if s, ok := v.(string); ok {
+			headers[k] = s
 		}
-
-		consumers = append(consumers, con)
 	}
 
-	m.createUser = consumers[0]
-	m.updateUser = consumers[1]
-	m.deleteUser = consumers[2]
-	m.createComputer = consumers[3]
-	m.updateComputer = consumers[4]
-	m.deleteComputer = consumers[5]
+	if msg.MessageId != "" {
+		headers[dedup.Header] = msg.MessageId
+	}
+	if msg.CorrelationId != "" {
+		headers[bus.HeaderCorrelationID] = msg.CorrelationId
+	}
+	if msg.ContentType != "" {
+		headers[codec.HeaderContentType] = msg.ContentType
+	}
 
-	return nil
+	return &bus.Message{
+		Topic:   queue,
+		Key:     msg.RoutingKey,
+		Headers: headers,
+		Payload: msg.Body,
+	}
 }
 
-func handleError(m *MsgBroker, val amqp.Delivery, logPrefix string, err error, msg string) {
-	m.logger.Error(fmt.Sprintf("error %s in %s: %s\n", msg, logPrefix, err.Error()))
+func (m *MsgBroker) Close() error {
+	return m.conn.Close()
 }
@@ -0,0 +1,287 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"practice/internal/pkg/bus"
+	"practice/internal/pkg/errs"
+	"slices"
+	"time"
+
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Every work queue Q gets:
+//
+//	Q.retry.N  for N in 1..RabbitMQ_MAX_RETRIES, holding a failed message for
+//	           RabbitMQ_RETRY_BACKOFF * 2^(N-1) before dead-lettering it
+//	           back to Q through the default exchange
+//	Q.dlx      a direct exchange for messages that will not be retried
+//	Q.dlq      the queue bound to Q.dlx, drained by the admin endpoints
+//
+// The attempt count travels in the x-attempts header.
+const (
+	headerAttempts      = "x-attempts"
+	headerError         = "x-last-error"
+	headerOriginalQueue = "x-original-queue"
+	headerDeadLettered  = "x-dead-lettered-at"
+)
+
+func retryQueue(queue string, attempt int) string {
+	return fmt.Sprintf("%s.retry.%d", queue, attempt)
+}
+
+func deadLetterExchange(queue string) string {
+	return queue + ".dlx"
+}
+
+func deadLetterQueue(queue string) string {
+	return queue + ".dlq"
+}
+
+func (m *MsgBroker) declareDeadLetters(ch *amqp.Channel, queue string) error {
+	for attempt := 1; attempt <= m.cfg.RabbitMQ_MAX_RETRIES; attempt++ {
+		ttl := m.cfg.RabbitMQ_RETRY_BACKOFF << (attempt - 1)
+
+		_, err := ch.QueueDeclare(retryQueue(queue, attempt), true, false, false, false, amqp.Table{
+			"x-message-ttl":             ttl.Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": queue,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "error while declaring retry queue for %s", queue)
+		}
+	}
+
+	if err := ch.ExchangeDeclare(deadLetterExchange(queue), amqp.ExchangeDirect, true, false, false, false, nil); err != nil {
+		return errors.Wrapf(err, "error while declaring dead-letter exchange for %s", queue)
+	}
+
+	if _, err := ch.QueueDeclare(deadLetterQueue(queue), true, false, false, false, nil); err != nil {
+		return errors.Wrapf(err, "error while declaring dead-letter queue for %s", queue)
+	}
+
+	if err := ch.QueueBind(deadLetterQueue(queue), queue, deadLetterExchange(queue), false, nil); err != nil {
+		return errors.Wrapf(err, "error while binding dead-letter queue for %s", queue)
+	}
+
+	return nil
+}
+
+// retryOrDeadLetter moves a failed delivery to its next retry queue, or to
+// the dead-letter exchange once retries are exhausted or the error is
+// permanent, and acks it once the broker confirms the copy. If the copy is
+// not confirmed the delivery is requeued.
+// sub.OnDeadLetter is told about dead-lettered messages.
+func (m *MsgBroker) retryOrDeadLetter(ctx context.Context, ch *channel, sub bus.Subscription, msg amqp.Delivery, cause error) {
+	queue := sub.Topic
+	attempts := attemptsOf(msg) + 1
+
+	headers := amqp.Table{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[headerAttempts] = int32(attempts)
+	headers[headerError] = cause.Error()
+	headers[headerOriginalQueue] = queue
+
+	exchange, key := "", retryQueue(queue, attempts)
+	deadLetter := !errs.Retryable(cause) || attempts > m.cfg.RabbitMQ_MAX_RETRIES
+	if deadLetter {
+		exchange, key = deadLetterExchange(queue), queue
+		headers[headerDeadLettered] = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	if err := m.republish(ctx, ch, exchange, key, msg, headers); err != nil {
+		m.logger.Error("error while rerouting failed message, requeueing", "queue", queue, "error", err.Error())
+		msg.Nack(false, true)
+		return
+	}
+
+	if deadLetter && sub.OnDeadLetter != nil {
+		sub.OnDeadLetter(ctx, messageOf(queue, msg), cause)
+	}
+
+	m.logger.Warn("rerouted failed message", "queue", queue, "attempt", attempts, "to", exchange+"/"+key)
+	msg.Ack(false)
+}
+
+// republish publishes a copy of msg as mandatory and waits for its confirm,
+// for at most the publish timeout.
+func (m *MsgBroker) republish(ctx context.Context, ch *channel, exchange, key string, msg amqp.Delivery, headers amqp.Table) error {
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.RabbitMQ_PUBLISH_TIMEOUT)
+	defer cancel()
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	return ch.PublishConfirmed(ctx, exchange, key, true, republishing(msg, headers))
+}
+
+// republishing copies msg with headers instead of its own, keeping the
+// message and correlation ids consumers rely on.
+func republishing(msg amqp.Delivery, headers amqp.Table) amqp.Publishing {
+	return amqp.Publishing{
+		Headers:         headers,
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    amqp.Persistent,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		ReplyTo:         msg.ReplyTo,
+		MessageId:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		AppId:           msg.AppId,
+		Body:            msg.Body,
+	}
+}
+
+func attemptsOf(msg amqp.Delivery) int {
+	switch v := msg.Headers[headerAttempts].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
+// DeadLetterQueues reports the depth of every dead-letter queue.
+func (m *MsgBroker) DeadLetterQueues() ([]bus.DeadLetterQueue, error) {
+	ch, err := m.conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	defer ch.Close()
+
+	m.mu.Lock()
+	queues := slices.Sorted(maps.Keys(m.queues))
+	m.mu.Unlock()
+
+	var res []bus.DeadLetterQueue
+	for _, queue := range queues {
+		q, err := ch.QueueDeclarePassive(deadLetterQueue(queue), true, false, false, false, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error while inspecting %s", deadLetterQueue(queue))
+		}
+
+		res = append(res, bus.DeadLetterQueue{Queue: queue, DeadLetter: q.Name, Messages: q.Messages})
+	}
+
+	return res, nil
+}
+
+// PeekDeadLetters returns up to limit messages from the dead-letter queue
+// of queue without removing them.
+func (m *MsgBroker) PeekDeadLetters(queue string, limit int) ([]bus.DeadLetter, error) {
+	var res []bus.DeadLetter
+
+	err := m.drainDeadLetters(queue, limit, func(_ *channel, msg amqp.Delivery) error {
+		res = append(res, toDeadLetter(queue, msg))
+		return msg.Nack(false, true)
+	})
+
+	return res, err
+}
+
+// ReplayDeadLetters moves up to limit messages from the dead-letter queue
+// of queue back to queue with a fresh attempt count. Each dead letter is
+// only removed once the broker confirms its copy.
+func (m *MsgBroker) ReplayDeadLetters(queue string, limit int) (int, error) {
+	var replayed int
+
+	err := m.drainDeadLetters(queue, limit, func(ch *channel, msg amqp.Delivery) error {
+		headers := amqp.Table{}
+		for k, v := range msg.Headers {
+			headers[k] = v
+		}
+		delete(headers, headerAttempts)
+		delete(headers, headerDeadLettered)
+
+		if err := m.republish(context.Background(), ch, "", queue, msg, headers); err != nil {
+			_ = msg.Nack(false, true)
+			return err
+		}
+
+		replayed++
+		return msg.Ack(false)
+	})
+
+	return replayed, err
+}
+
+// drainDeadLetters fetches up to limit messages from the dead-letter queue
+// of queue on a dedicated channel and hands each one to fn, which must ack
+// or nack it.
+func (m *MsgBroker) drainDeadLetters(queue string, limit int, fn func(ch *channel, msg amqp.Delivery) error) error {
+	if !m.isKnownQueue(queue) {
+		return errs.NotFound("unknown queue: " + queue)
+	}
+
+	confirmCh, err := m.conn.ConfirmChannel()
+	if err != nil {
+		return err
+	}
+	defer confirmCh.Close()
+
+	ch := &channel{ConfirmChannel: confirmCh}
+
+	// Messages nacked back to the queue would be fetched again, so hold
+	// them unacknowledged until the whole batch is collected.
+	var batch []amqp.Delivery
+	for len(batch) < limit {
+		msg, ok, err := ch.Get(deadLetterQueue(queue), false)
+		if err != nil {
+			return errors.Wrapf(err, "error while reading %s", deadLetterQueue(queue))
+		}
+		if !ok {
+			break
+		}
+		batch = append(batch, msg)
+	}
+
+	for _, msg := range batch {
+		if err := fn(ch, msg); err != nil {
+			return errors.Wrap(err, "error while handling dead letter")
+		}
+	}
+
+	return nil
+}
+
+func (m *MsgBroker) isKnownQueue(queue string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.queues[queue]
+}
+
+func toDeadLetter(queue string, msg amqp.Delivery) bus.DeadLetter {
+	dl := bus.DeadLetter{
+		MessageID:   msg.MessageId,
+		Queue:       queue,
+		Attempts:    attemptsOf(msg),
+		ContentType: msg.ContentType,
+		Headers:     map[string]any{},
+		Body:        string(msg.Body),
+	}
+
+	for k, v := range msg.Headers {
+		switch k {
+		case headerError:
+			dl.LastError, _ = v.(string)
+		case headerDeadLettered:
+			dl.DeadLetteredAt, _ = v.(string)
+		case headerAttempts, headerOriginalQueue:
+		default:
+			dl.Headers[k] = v
+		}
+	}
+
+	return dl
+}
@@ -0,0 +1,59 @@
+package producer
+
+import "practice/internal/rabbitmq/connection"
+
+// pool hands every publisher a channel of its own, since amqp.Channel is
+// not safe for concurrent publishing. Up to size idle channels are kept for
+// reuse; publishers beyond those open new ones, closed when returned.
+type pool struct {
+	conn *connection.Connection
+	idle chan *connection.ConfirmChannel
+}
+
+func newPool(conn *connection.Connection, size int) *pool {
+	return &pool{
+		conn: conn,
+		idle: make(chan *connection.ConfirmChannel, max(size, 0)),
+	}
+}
+
+// get takes an idle channel, skipping those closed along with a lost
+// connection, or opens a new one.
+func (p *pool) get() (*connection.ConfirmChannel, error) {
+	for {
+		select {
+		case ch := <-p.idle:
+			if ch.IsClosed() {
+				continue
+			}
+			return ch, nil
+		default:
+			return p.conn.ConfirmChannel()
+		}
+	}
+}
+
+// put returns ch for reuse. Channels that failed a publish should be
+// closed instead, as their state is unknown.
+func (p *pool) put(ch *connection.ConfirmChannel) {
+	if ch.IsClosed() {
+		return
+	}
+
+	select {
+	case p.idle <- ch:
+	default:
+		ch.Close()
+	}
+}
+
+func (p *pool) close() {
+	for {
+		select {
+		case ch := <-p.idle:
+			ch.Close()
+		default:
+			return
+		}
+	}
+}
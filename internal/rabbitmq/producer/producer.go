@@ -1,69 +1,132 @@
 package producer
 
 import (
+	"context"
 	"log/slog"
+	"practice/internal/pkg/bus"
+	"practice/internal/pkg/codec"
 	"practice/internal/pkg/config"
+	"practice/internal/pkg/dedup"
+	"practice/internal/rabbitmq/connection"
+	"practice/internal/rabbitmq/topology"
+	"sync"
+	"time"
 
+	"github.com/pkg/errors"
 	amqp "github.com/rabbitmq/amqp091-go"
-	"go.uber.org/fx"
 )
 
-var Module = fx.Provide(New)
-
-type Options struct {
-	fx.In
+type MsgBroker struct {
+	conn     *connection.Connection
+	pool     *pool
+	topology *topology.Topology
+	logger   *slog.Logger
+	timeout  time.Duration
 
-	Logger *slog.Logger
-	Cfg    *config.Config
+	mu       sync.Mutex
+	declared uint64
 }
 
-type MsgBroker struct {
-	channel *amqp.Channel
-	logger  *slog.Logger
+func New(conn *connection.Connection, topo *topology.Topology, cfg *config.Config, logger *slog.Logger) *MsgBroker {
+	return &MsgBroker{
+		conn:     conn,
+		pool:     newPool(conn, cfg.RabbitMQ_CHANNEL_POOL_SIZE),
+		topology: topo,
+		logger:   logger,
+		timeout:  cfg.RabbitMQ_PUBLISH_TIMEOUT,
+	}
 }
 
-func NewChannel(cfg *config.Config) (*amqp.Channel, error) {
-	conn, err := amqp.Dial(cfg.RabbitMQ_ADDRESS)
-	if err != nil {
-		return nil, err
+// PublishTo sends body to exchange as a persistent message, declaring the
+// topology first on every new connection; an empty exchange is the default
+// one, which routes straight to the queue named by routingKey.
+// It returns once the broker confirms it has taken responsibility for the
+// message, failing if it is nacked, not confirmed within the publish
+// timeout or, when mandatory, returned because no queue is bound for it.
+// While the connection is down it fails right away, leaving the retry to
+// the caller.
+//
+// The dedup.Header, bus.HeaderCorrelationID and codec.HeaderContentType
+// entries of headers, if any, become the AMQP message id, correlation id
+// and content type; the rest are sent as message headers.
+func (m *MsgBroker) PublishTo(ctx context.Context, exchange, routingKey string, mandatory bool, body []byte, headers map[string]string) error {
+	publishing := amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    time.Now().UTC(),
+		Body:         body,
+	}
+
+	for key, value := range headers {
+		switch key {
+		case dedup.Header:
+			publishing.MessageId = value
+			continue
+		case bus.HeaderCorrelationID:
+			publishing.CorrelationId = value
+			continue
+		case codec.HeaderContentType:
+			publishing.ContentType = value
+			continue
+		}
+		if publishing.Headers == nil {
+			publishing.Headers = amqp.Table{}
+		}
+		publishing.Headers[key] = value
 	}
 
-	channel, err := conn.Channel()
+	ch, err := m.pool.get()
 	if err != nil {
-		return nil, err
+		return errors.Wrapf(err, "error while publishing to %s", exchange)
 	}
 
-	return channel, nil
-}
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
 
-func New(opts Options) *MsgBroker {
-	ch, err := NewChannel(opts.Cfg)
-	if err != nil {
-		return nil
+	if err := m.publish(ctx, ch, exchange, routingKey, mandatory, publishing); err != nil {
+		ch.Close()
+		m.logger.Error("failed to publish to rabbitmq", "exchange", exchange, "key", routingKey, "error", err.Error())
+		return err
 	}
+	m.pool.put(ch)
 
-	return &MsgBroker{
-		channel: ch,
-		logger:  opts.Logger,
+	m.logger.Info("published to rabbitmq", "exchange", exchange, "key", routingKey, "messageId", publishing.MessageId)
+	return nil
+}
+
+func (m *MsgBroker) publish(ctx context.Context, ch *connection.ConfirmChannel, exchange, routingKey string, mandatory bool, publishing amqp.Publishing) error {
+	if err := m.declare(ch.Channel); err != nil {
+		return err
 	}
+
+	return ch.PublishConfirmed(ctx, exchange, routingKey, mandatory, publishing)
 }
 
-func (m *MsgBroker) Publish(queueName string, body []byte) error {
-	err := m.channel.Publish(
-		"",
-		queueName,
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		},
-	)
-	if err != nil {
-		m.logger.Error("failed to publish to rabbitmq", "queue", queueName, "error", err.Error())
+// declare declares the topology once per connection, so it is redone after
+// a reconnect in case the broker lost it.
+func (m *MsgBroker) declare(ch *amqp.Channel) error {
+	generation := m.conn.Generation()
+
+	m.mu.Lock()
+	declared := m.declared == generation
+	m.mu.Unlock()
+
+	if declared {
+		return nil
+	}
+
+	if err := m.topology.Declare(ch); err != nil {
 		return err
 	}
 
-	m.logger.Info("published to rabbitmq", "queue", queueName)
+	m.mu.Lock()
+	m.declared = generation
+	m.mu.Unlock()
+
 	return nil
 }
+
+func (m *MsgBroker) Close() error {
+	m.pool.close()
+	return m.conn.Close()
+}
@@ -1,13 +1,109 @@
 package rabbitmq
 
 import (
+	"context"
+	"log/slog"
+	"practice/internal/pkg/bus"
+	"practice/internal/pkg/config"
+	"practice/internal/pkg/outbox"
+	"practice/internal/rabbitmq/connection"
 	"practice/internal/rabbitmq/consumer"
 	"practice/internal/rabbitmq/producer"
+	"practice/internal/rabbitmq/topology"
+	"slices"
 
+	"github.com/pkg/errors"
 	"go.uber.org/fx"
 )
 
-var Module = fx.Options(
-	producer.Module,
-	consumer.Module,
-)
+var Module = fx.Provide(fx.Annotate(New, fx.ResultTags(`group:"buses"`)))
+
+type Options struct {
+	fx.In
+	fx.Lifecycle
+	Cfg    *config.Config
+	Logger *slog.Logger
+}
+
+// Bus publishes to the exchanges of a config-driven topology and consumes
+// each topic from the queue of the same name. Dead letters are kept in
+// per-queue dead-letter queues.
+type Bus struct {
+	topology *topology.Topology
+	producer *producer.MsgBroker
+	consumer *consumer.MsgBroker
+}
+
+// New connects to RabbitMQ in the background, with separate connections
+// for publishing and consuming so that flow control on one does not stall
+// the other. Both are redialled whenever they drop, so the bus is available
+// even if the broker is not reachable yet; publishes fail until it is. An
+// invalid topology fails startup.
+func New(opts Options) (bus.Bus, error) {
+	if !slices.Contains(opts.Cfg.BUS_TRANSPORTS, outbox.TransportRabbitMQ) {
+		return nil, nil
+	}
+
+	topo, err := topology.New(opts.Cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "error in rabbitmq topology")
+	}
+
+	prod := producer.New(dial(opts, "producer"), topo, opts.Cfg, opts.Logger)
+	cons := consumer.New(dial(opts, "consumer"), topo, opts.Cfg, opts.Logger)
+
+	opts.Lifecycle.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			prod.Close()
+			return cons.Close()
+		},
+	})
+
+	return &Bus{
+		topology: topo,
+		producer: prod,
+		consumer: cons,
+	}, nil
+}
+
+func dial(opts Options, name string) *connection.Connection {
+	return connection.New(connection.Config{
+		Name:       name,
+		Address:    opts.Cfg.RabbitMQ_ADDRESS,
+		Backoff:    opts.Cfg.RabbitMQ_RECONNECT_BACKOFF,
+		MaxBackoff: opts.Cfg.RabbitMQ_RECONNECT_MAX_BACKOFF,
+	}, opts.Logger)
+}
+
+func (b *Bus) Name() string {
+	return outbox.TransportRabbitMQ
+}
+
+// Publish waits for the broker to confirm msg. Topics naming a command
+// queue are published to the commands exchange under the routing key of
+// the queue, as mandatory, so a command no queue is bound for fails instead
+// of being dropped. Any other topic is taken as an exchange and msg.Key as
+// the routing key; those are not mandatory, as nobody may be subscribed to
+// events.
+func (b *Bus) Publish(ctx context.Context, msg *bus.Message) error {
+	if route, ok := b.topology.Route(msg.Topic); ok {
+		return b.producer.PublishTo(ctx, route.Exchange, route.Key, true, msg.Payload, msg.Headers)
+	}
+	return b.producer.PublishTo(ctx, msg.Topic, msg.Key, false, msg.Payload, msg.Headers)
+}
+
+func (b *Bus) Subscribe(ctx context.Context, sub bus.Subscription) error {
+	return b.consumer.Consume(ctx, sub)
+}
+
+func (b *Bus) DeadLetterQueues() ([]bus.DeadLetterQueue, error) {
+	return b.consumer.DeadLetterQueues()
+}
+
+func (b *Bus) PeekDeadLetters(topic string, limit int) ([]bus.DeadLetter, error) {
+	return b.consumer.PeekDeadLetters(topic, limit)
+}
+
+func (b *Bus) ReplayDeadLetters(topic string, limit int) (int, error) {
+	return b.consumer.ReplayDeadLetters(topic, limit)
+}
@@ -0,0 +1,149 @@
+package topology
+
+import (
+	"practice/internal/pkg/config"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var kinds = []string{amqp.ExchangeDirect, amqp.ExchangeFanout, amqp.ExchangeTopic, amqp.ExchangeHeaders}
+
+type Exchange struct {
+	Name string
+	Kind string
+}
+
+// Binding routes the messages of Exchange whose routing key matches
+// Pattern to Queue. Fanout exchanges ignore the pattern.
+type Binding struct {
+	Queue    string
+	Exchange string
+	Pattern  string
+}
+
+// Route is where the messages of a topic are published.
+type Route struct {
+	Exchange string
+	Key      string
+}
+
+// Topology is the layout of exchanges, queues and bindings the bus relies
+// on. It is built from the config:
+//
+//	RabbitMQ_EXCHANGES        name:kind entries, kind one of direct, fanout,
+//	                          topic (the default) or headers
+//	RabbitMQ_EXCHANGE_COMMANDS the topic exchange commands are published to,
+//	                          each command queue bound to it by the routing
+//	                          key of its command type
+//	RabbitMQ_EXCHANGE_EVENTS  the exchange events are published to, by
+//	                          event routing key such as user.created
+//	RabbitMQ_BINDINGS         extra queue=exchange:pattern entries
+//
+// The commands and events exchanges are declared as topic exchanges unless
+// listed with another kind, e.g. practice.events:fanout.
+type Topology struct {
+	Exchanges []Exchange
+	Bindings  []Binding
+	routes    map[string]Route
+}
+
+func New(cfg *config.Config) (*Topology, error) {
+	t := &Topology{routes: map[string]Route{}}
+
+	for _, def := range cfg.RabbitMQ_EXCHANGES {
+		name, kind, _ := strings.Cut(def, ":")
+		if kind == "" {
+			kind = amqp.ExchangeTopic
+		}
+		if name == "" || !slices.Contains(kinds, kind) {
+			return nil, errors.Errorf("invalid exchange %q", def)
+		}
+		t.addExchange(name, kind)
+	}
+
+	t.addExchange(cfg.RabbitMQ_EXCHANGE_COMMANDS, amqp.ExchangeTopic)
+	if cfg.RabbitMQ_EXCHANGE_EVENTS != "" {
+		t.addExchange(cfg.RabbitMQ_EXCHANGE_EVENTS, amqp.ExchangeTopic)
+	}
+
+	commands := []Binding{
+		{cfg.RabbitMQ_QUEUE_USER_CREATED, cfg.RabbitMQ_EXCHANGE_COMMANDS, cfg.RabbitMQ_ROUTING_KEY_USER_CREATED},
+		{cfg.RabbitMQ_QUEUE_USER_UPDATED, cfg.RabbitMQ_EXCHANGE_COMMANDS, cfg.RabbitMQ_ROUTING_KEY_USER_UPDATED},
+		{cfg.RabbitMQ_QUEUE_USER_PATCHED, cfg.RabbitMQ_EXCHANGE_COMMANDS, cfg.RabbitMQ_ROUTING_KEY_USER_PATCHED},
+		{cfg.RabbitMQ_QUEUE_USER_DELETED, cfg.RabbitMQ_EXCHANGE_COMMANDS, cfg.RabbitMQ_ROUTING_KEY_USER_DELETED},
+		{cfg.RabbitMQ_QUEUE_COMPUTER_CREATED, cfg.RabbitMQ_EXCHANGE_COMMANDS, cfg.RabbitMQ_ROUTING_KEY_COMPUTER_CREATED},
+		{cfg.RabbitMQ_QUEUE_COMPUTER_UPDATED, cfg.RabbitMQ_EXCHANGE_COMMANDS, cfg.RabbitMQ_ROUTING_KEY_COMPUTER_UPDATED},
+		{cfg.RabbitMQ_QUEUE_COMPUTER_PATCHED, cfg.RabbitMQ_EXCHANGE_COMMANDS, cfg.RabbitMQ_ROUTING_KEY_COMPUTER_PATCHED},
+		{cfg.RabbitMQ_QUEUE_COMPUTER_DELETED, cfg.RabbitMQ_EXCHANGE_COMMANDS, cfg.RabbitMQ_ROUTING_KEY_COMPUTER_DELETED},
+	}
+	for _, b := range commands {
+		t.routes[b.Queue] = Route{Exchange: b.Exchange, Key: b.Pattern}
+		t.Bindings = append(t.Bindings, b)
+	}
+
+	for _, def := range cfg.RabbitMQ_BINDINGS {
+		queue, target, _ := strings.Cut(def, "=")
+		exchange, pattern, _ := strings.Cut(target, ":")
+		if queue == "" || exchange == "" {
+			return nil, errors.Errorf("invalid binding %q", def)
+		}
+		if !t.hasExchange(exchange) {
+			return nil, errors.Errorf("binding %q refers to undeclared exchange %s", def, exchange)
+		}
+		t.Bindings = append(t.Bindings, Binding{Queue: queue, Exchange: exchange, Pattern: pattern})
+	}
+
+	return t, nil
+}
+
+// addExchange keeps the kind of an exchange listed earlier.
+func (t *Topology) addExchange(name, kind string) {
+	if !t.hasExchange(name) {
+		t.Exchanges = append(t.Exchanges, Exchange{Name: name, Kind: kind})
+	}
+}
+
+func (t *Topology) hasExchange(name string) bool {
+	return slices.ContainsFunc(t.Exchanges, func(e Exchange) bool { return e.Name == name })
+}
+
+// Route returns where the messages of a command queue are published.
+func (t *Topology) Route(topic string) (Route, bool) {
+	r, ok := t.routes[topic]
+	return r, ok
+}
+
+// HasQueue reports whether queue is bound to any exchange.
+func (t *Topology) HasQueue(queue string) bool {
+	return slices.ContainsFunc(t.Bindings, func(b Binding) bool { return b.Queue == queue })
+}
+
+// Declare declares every exchange, queue and binding as durable. It is
+// idempotent, so it is run again on every new connection in case the
+// broker lost them.
+func (t *Topology) Declare(ch *amqp.Channel) error {
+	for _, e := range t.Exchanges {
+		if err := ch.ExchangeDeclare(e.Name, e.Kind, true, false, false, false, nil); err != nil {
+			return errors.Wrapf(err, "error while declaring exchange %s", e.Name)
+		}
+	}
+
+	declared := map[string]bool{}
+	for _, b := range t.Bindings {
+		if !declared[b.Queue] {
+			if _, err := ch.QueueDeclare(b.Queue, true, false, false, false, nil); err != nil {
+				return errors.Wrapf(err, "error while declaring queue %s", b.Queue)
+			}
+			declared[b.Queue] = true
+		}
+
+		if err := ch.QueueBind(b.Queue, b.Pattern, b.Exchange, false, nil); err != nil {
+			return errors.Wrapf(err, "error while binding queue %s to %s", b.Queue, b.Exchange)
+		}
+	}
+
+	return nil
+}
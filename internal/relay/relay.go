@@ -0,0 +1,187 @@
+package relay
+
+import (
+	"context"
+	"log/slog"
+	"practice/internal/pkg/bus"
+	"practice/internal/pkg/config"
+	"practice/internal/pkg/outbox"
+	mongoOutbox "practice/internal/repository/mongodb/outbox"
+	pgOutbox "practice/internal/repository/postgres/outbox"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/fx"
+)
+
+// maxBackoff caps the exponential delay between delivery attempts.
+const maxBackoff = 5 * time.Minute
+
+var Module = fx.Options(fx.Invoke(New))
+
+type Options struct {
+	fx.In
+	fx.Lifecycle
+	Cfg            *config.Config
+	Logger         *slog.Logger
+	PostgresOutbox pgOutbox.RepositoryOutbox
+	MongoOutbox    mongoOutbox.RepositoryOutbox
+	Buses          *bus.Registry
+}
+
+// Relay polls the outbox stores and publishes pending messages, retrying
+// failures with exponential backoff until OUTBOX_MAX_ATTEMPTS is reached.
+// Exhausted messages stay in their store with the last error for
+// inspection. Sent messages are purged every OUTBOX_PURGE_INTERVAL once
+// older than OUTBOX_SENT_RETENTION.
+type Relay struct {
+	cfg    *config.Config
+	logger *slog.Logger
+	stores map[string]outbox.Store
+	buses  *bus.Registry
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New(opts Options) (*Relay, error) {
+	if opts.Cfg.OUTBOX_SENT_RETENTION > 0 && opts.Cfg.OUTBOX_PURGE_INTERVAL <= 0 {
+		return nil, errors.New("OUTBOX_PURGE_INTERVAL must be positive")
+	}
+
+	relay := &Relay{
+		cfg:    opts.Cfg,
+		logger: opts.Logger,
+		stores: map[string]outbox.Store{
+			"postgres": opts.PostgresOutbox,
+			"mongodb":  opts.MongoOutbox,
+		},
+		buses: opts.Buses,
+	}
+
+	opts.Lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			ctx, cancel := context.WithCancel(context.Background())
+			relay.cancel = cancel
+
+			for name, store := range relay.stores {
+				relay.wg.Add(1)
+				go relay.run(ctx, name, store)
+			}
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			relay.cancel()
+			relay.wg.Wait()
+			return nil
+		},
+	})
+
+	return relay, nil
+}
+
+func (r *Relay) run(ctx context.Context, name string, store outbox.Store) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.cfg.OUTBOX_POLL_INTERVAL)
+	defer ticker.Stop()
+
+	// A nil channel never fires, so sent messages are kept.
+	var purge <-chan time.Time
+	if r.cfg.OUTBOX_SENT_RETENTION > 0 {
+		purgeTicker := time.NewTicker(r.cfg.OUTBOX_PURGE_INTERVAL)
+		defer purgeTicker.Stop()
+		purge = purgeTicker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.flush(ctx, store); err != nil && ctx.Err() == nil {
+				r.logger.Error("outbox relay failed", "store", name, "error", err.Error())
+			}
+		case <-purge:
+			r.purge(ctx, name, store)
+		}
+	}
+}
+
+// purge removes the messages sent longer than OUTBOX_SENT_RETENTION ago,
+// in batches.
+func (r *Relay) purge(ctx context.Context, name string, store outbox.Store) {
+	before := time.Now().Add(-r.cfg.OUTBOX_SENT_RETENTION)
+	batch := max(r.cfg.OUTBOX_BATCH_SIZE, 1)
+
+	total := 0
+	for ctx.Err() == nil {
+		n, err := store.PurgeSent(ctx, before, batch)
+		if err != nil {
+			if ctx.Err() == nil {
+				r.logger.Error("outbox purge failed", "store", name, "error", err.Error())
+			}
+			break
+		}
+
+		total += n
+		if n < batch {
+			break
+		}
+	}
+
+	if total > 0 {
+		r.logger.Info("purged sent outbox messages", "store", name, "count", total, "sentBefore", before)
+	}
+}
+
+// flush publishes one claimed batch. Store errors abort the batch; the
+// lease then expires and the messages are claimed again.
+func (r *Relay) flush(ctx context.Context, store outbox.Store) error {
+	msgs, err := store.Claim(ctx, r.cfg.OUTBOX_BATCH_SIZE, r.cfg.OUTBOX_MAX_ATTEMPTS, r.cfg.OUTBOX_LEASE)
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range msgs {
+		if err := r.publish(ctx, msg); err != nil {
+			retryAt := time.Now().Add(r.backoff(msg.Attempts))
+			r.logger.Warn("outbox publish failed",
+				"id", msg.ID, "transport", msg.Transport, "topic", msg.Topic,
+				"attempt", msg.Attempts+1, "retryAt", retryAt, "error", err.Error())
+
+			if err := store.MarkFailed(ctx, msg.ID, err.Error(), retryAt); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := store.MarkSent(ctx, msg.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Relay) publish(ctx context.Context, msg *outbox.Message) error {
+	b, ok := r.buses.Get(msg.Transport)
+	if !ok {
+		return errors.Errorf("transport %q is not available", msg.Transport)
+	}
+
+	return b.Publish(ctx, &bus.Message{
+		Topic:   msg.Topic,
+		Key:     msg.Key,
+		Headers: msg.Headers,
+		Payload: msg.Payload,
+	})
+}
+
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.cfg.OUTBOX_RETRY_BACKOFF << attempts
+	if d <= 0 || d > maxBackoff {
+		return maxBackoff
+	}
+	return d
+}
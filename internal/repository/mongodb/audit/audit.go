@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"context"
+	"log/slog"
+	"practice/internal/pkg/audit"
+	"practice/internal/pkg/config"
+	"practice/internal/repository/mongodb"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/fx"
+)
+
+var Module = fx.Provide(New)
+
+// RepositoryAudit keeps the history of MongoDB-backed entities. Nothing
+// enforces that it is append-only but the absence of other writes.
+type RepositoryAudit interface {
+	audit.Store
+}
+
+type Repository struct {
+	repo       *mongodb.MongoDB
+	collection *mongo.Collection
+	logger     *slog.Logger
+}
+
+type Options struct {
+	fx.In
+	fx.Lifecycle
+	Cfg    *config.Config
+	Mongo  *mongodb.MongoDB
+	Logger *slog.Logger
+}
+
+var _ RepositoryAudit = (*Repository)(nil)
+
+func New(opts Options) RepositoryAudit {
+	repo := &Repository{
+		logger: opts.Logger,
+	}
+
+	opts.Lifecycle.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			repo.repo = opts.Mongo
+			repo.collection = repo.repo.DB.Collection(opts.Cfg.MongoDB_AUDIT_COLLECTION)
+
+			_, err := repo.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{
+					{Key: "entity", Value: 1},
+					{Key: "entityId", Value: 1},
+					{Key: "changedAt", Value: -1},
+					{Key: "_id", Value: -1},
+				},
+			})
+			return errors.Wrap(err, "error while creating audit index")
+		},
+		OnStop: func(context.Context) error { return nil },
+	})
+
+	return repo
+}
+
+func (r *Repository) Add(ctx context.Context, entry *audit.Entry) error {
+	_, err := r.collection.InsertOne(ctx, entry)
+	return errors.Wrap(err, "error while inserting audit entry")
+}
+
+func (r *Repository) List(ctx context.Context, entity, entityID string, params *audit.ListParams) (*audit.Page, error) {
+	filter := bson.M{"entity": entity, "entityId": entityID}
+
+	if params.Cursor != "" {
+		c, err := audit.DecodeCursor(params.Cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		filter["$or"] = bson.A{
+			bson.M{"changedAt": bson.M{"$lt": c.ChangedAt}},
+			bson.M{"changedAt": c.ChangedAt, "_id": bson.M{"$lt": c.ID}},
+		}
+	}
+
+	// One extra document tells us whether there is a next page.
+	opts := options.Find().
+		SetSort(bson.D{{Key: "changedAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(params.Limit + 1))
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "error while finding audit entries")
+	}
+
+	res := make([]*audit.Entry, 0, params.Limit+1)
+	if err = cursor.All(ctx, &res); err != nil {
+		return nil, errors.Wrap(err, "error while decoding audit entries")
+	}
+
+	page := &audit.Page{Items: res}
+	if len(res) > params.Limit {
+		page.Items = res[:params.Limit]
+		page.NextCursor = audit.NextCursor(page.Items[len(page.Items)-1])
+	}
+
+	return page, nil
+}
@@ -0,0 +1,122 @@
+package command
+
+import (
+	"context"
+	"log/slog"
+	"practice/internal/pkg/command"
+	"practice/internal/pkg/config"
+	"practice/internal/pkg/errs"
+	"practice/internal/repository/mongodb"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/fx"
+)
+
+var Module = fx.Provide(New)
+
+// RepositoryCommand tracks async commands on MongoDB-backed aggregates.
+type RepositoryCommand interface {
+	command.Store
+}
+
+type Repository struct {
+	repo       *mongodb.MongoDB
+	collection *mongo.Collection
+	logger     *slog.Logger
+}
+
+type Options struct {
+	fx.In
+	fx.Lifecycle
+	Cfg    *config.Config
+	Mongo  *mongodb.MongoDB
+	Logger *slog.Logger
+}
+
+var _ RepositoryCommand = (*Repository)(nil)
+
+func New(opts Options) RepositoryCommand {
+	repo := &Repository{
+		logger: opts.Logger,
+	}
+
+	opts.Lifecycle.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			repo.repo = opts.Mongo
+			repo.collection = repo.repo.DB.Collection(opts.Cfg.MongoDB_COMMANDS_COLLECTION)
+			return nil
+		},
+		OnStop: func(context.Context) error { return nil },
+	})
+
+	return repo
+}
+
+func (r *Repository) Add(ctx context.Context, cmd *command.Command) error {
+	now := time.Now().UTC()
+	cmd.Status = command.StatusPending
+	cmd.CreatedAt = now
+	cmd.UpdatedAt = now
+
+	if _, err := r.collection.InsertOne(ctx, cmd); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return errs.Wrap(errs.KindConflict, err, "command already exists")
+		}
+		return errors.Wrap(err, "error while inserting command")
+	}
+
+	return nil
+}
+
+func (r *Repository) Get(ctx context.Context, id string) (*command.Command, error) {
+	var cmd command.Command
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&cmd); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errs.Wrap(errs.KindNotFound, err, "command not found")
+		}
+
+		return nil, errors.Wrap(err, "error while finding command")
+	}
+
+	return &cmd, nil
+}
+
+func (r *Repository) Succeed(ctx context.Context, id, entityID string) error {
+	now := time.Now().UTC()
+
+	_, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{
+			"$set":         bson.M{"status": command.StatusSucceeded, "entityId": entityID, "error": "", "updatedAt": now},
+			"$setOnInsert": bson.M{"createdAt": now},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return errors.Wrap(err, "error while marking command succeeded")
+}
+
+func (r *Repository) Fail(ctx context.Context, id, cause string) error {
+	now := time.Now().UTC()
+
+	_, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "status": bson.M{"$ne": command.StatusSucceeded}},
+		bson.M{
+			"$set":         bson.M{"status": command.StatusFailed, "error": cause, "updatedAt": now},
+			"$setOnInsert": bson.M{"createdAt": now},
+		},
+		options.Update().SetUpsert(true),
+	)
+	// The upsert collides with a command that has already succeeded, which
+	// must keep its status.
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+
+	return errors.Wrap(err, "error while marking command failed")
+}
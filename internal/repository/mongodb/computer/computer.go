@@ -2,14 +2,21 @@ package computer
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"log/slog"
 	"practice/internal/pkg/config"
+	"practice/internal/pkg/errs"
 	"practice/internal/repository/mongodb"
+	"regexp"
+	"time"
 
 	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/fx"
 )
 
@@ -19,8 +26,15 @@ type RepositoryComputer interface {
 	Create(ctx context.Context, computer *Computer) (*Computer, error)
 	Read(ctx context.Context, compID string) (*Computer, error)
 	Update(ctx context.Context, computer *Computer) (string, error)
-	Delete(ctx context.Context, compID string) (string, error)
-	GetAll(ctx context.Context) ([]*Computer, error)
+	Patch(ctx context.Context, patch *Patch) (string, error)
+	Find(ctx context.Context, compID string) (*Computer, error)
+	Owned(ctx context.Context, ownerID string) ([]*Computer, error)
+	SetOwner(ctx context.Context, compID, ownerID string, version int) (*Computer, error)
+	Delete(ctx context.Context, compID, deletedBy string) (string, error)
+	Restore(ctx context.Context, compID string) (*Computer, error)
+	Purge(ctx context.Context, compID string) error
+	PurgeDeleted(ctx context.Context, before time.Time, limit int) ([]*Computer, error)
+	List(ctx context.Context, params *ListParams) (*Page, error)
 }
 
 type Repository struct {
@@ -48,7 +62,39 @@ func New(opts Options) RepositoryComputer {
 		OnStart: func(ctx context.Context) error {
 			repo.repo = opts.Mongo
 			repo.collection = repo.repo.DB.Collection(opts.Cfg.MongoDB_COLLECTION)
-			return nil
+
+			// Computers deleted before the deletion time was recorded
+			// start their retention period now.
+			if _, err := repo.collection.UpdateMany(ctx,
+				bson.M{"isDeleted": true, "deletedAt": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"deletedAt": time.Now().UTC()}},
+			); err != nil {
+				return errors.Wrap(err, "error while backfilling computer deletion times")
+			}
+
+			// Computers created before the timestamps were recorded get
+			// the creation time of their id and start their updates now.
+			if _, err := repo.collection.UpdateMany(ctx,
+				bson.M{"createdAt": bson.M{"$exists": false}},
+				mongo.Pipeline{{{Key: "$set", Value: bson.M{
+					"createdAt": bson.M{"$toDate": "$_id"},
+					"updatedAt": time.Now().UTC(),
+				}}}},
+			); err != nil {
+				return errors.Wrap(err, "error while backfilling computer timestamps")
+			}
+
+			_, err := repo.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "deletedAt", Value: 1}},
+					Options: options.Index().SetPartialFilterExpression(bson.M{"isDeleted": true}),
+				},
+				{
+					Keys:    bson.D{{Key: "ownerId", Value: 1}},
+					Options: options.Index().SetSparse(true),
+				},
+			})
+			return errors.Wrap(err, "error while creating computer indexes")
 		},
 		OnStop: func(context.Context) error { return nil },
 	})
@@ -57,8 +103,16 @@ func New(opts Options) RepositoryComputer {
 }
 
 func (r *Repository) Create(ctx context.Context, computer *Computer) (*Computer, error) {
+	// MongoDB keeps milliseconds; truncating returns what later reads do.
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	computer.Version = 1
+	computer.CreatedAt, computer.UpdatedAt = &now, &now
+
 	res, err := r.collection.InsertOne(ctx, computer)
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, errs.Wrap(errs.KindConflict, err, "computer already exists")
+		}
 		return nil, errors.Wrap(err, "error while inserting computer")
 	}
 
@@ -68,61 +122,195 @@ func (r *Repository) Create(ctx context.Context, computer *Computer) (*Computer,
 }
 
 func (r *Repository) Read(ctx context.Context, compID string) (*Computer, error) {
-	objID, err := primitive.ObjectIDFromHex(compID)
+	res, err := r.find(ctx, compID)
 	if err != nil {
-		return nil, errors.Wrap(err, "error while parsing object id")
+		return nil, err
+	}
+
+	if res.IsDeleted {
+		return nil, errs.AlreadyDeleted("computer is deleted")
+	}
+
+	return res, nil
+}
+
+// Find returns the computer, deleted or not. Inside a transaction, writes
+// of others to it since make the transaction retry, so it is the state the
+// writes of the transaction apply to.
+func (r *Repository) Find(ctx context.Context, compID string) (*Computer, error) {
+	return r.find(ctx, compID)
+}
+
+// find returns the computer, deleted or not.
+func (r *Repository) find(ctx context.Context, compID string) (*Computer, error) {
+	objID, err := parseID(compID)
+	if err != nil {
+		return nil, err
 	}
 
 	var res Computer
 	if err = r.collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&res); err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.Wrap(err, "not found")
+			return nil, errs.Wrap(errs.KindNotFound, err, "computer not found")
 		}
 
 		return nil, errors.Wrap(err, "error while finding computer")
 	}
 
-	if res.IsDeleted {
-		return nil, errors.Wrap(mongo.ErrNoDocuments, "deleted")
-	}
-
 	return &res, nil
 }
 
+// Update overwrites the computer if it still has computer.Version, or
+// regardless of its version when that is zero, and sets computer.Version to
+// the new one.
 func (r *Repository) Update(ctx context.Context, computer *Computer) (string, error) {
-	res, err := r.collection.UpdateByID(ctx, computer.ID, bson.M{"$set": computer})
+	return r.write(ctx, computer, []string{"ip", "manufacturer", "cpu", "ram", "hdd", "gpu", "os", "ownerId"})
+}
+
+// Patch writes only patch.Fields of patch.Computer, under the same version
+// rule as Update, and sets patch.Computer to the stored result.
+func (r *Repository) Patch(ctx context.Context, patch *Patch) (string, error) {
+	if err := patch.CheckFields(); err != nil {
+		return "", err
+	}
+	return r.write(ctx, &patch.Computer, patch.Fields)
+}
+
+func (r *Repository) write(ctx context.Context, computer *Computer, fields []string) (string, error) {
+	if len(fields) == 0 {
+		return computer.ID.Hex(), r.current(ctx, computer)
+	}
+
+	set, unset := bson.M{"updatedAt": time.Now().UTC()}, bson.M{}
+	for _, f := range fields {
+		// Unassigned computers have no owner rather than an empty one.
+		if f == "ownerId" && computer.OwnerID == "" {
+			unset[patchFields[f]] = ""
+			continue
+		}
+		set[patchFields[f]] = computer.patchValue(f)
+	}
+
+	update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	filter := bson.M{"_id": computer.ID, "isDeleted": false}
+	if computer.Version != 0 {
+		filter["version"] = computer.Version
+	}
+
+	err := r.collection.FindOneAndUpdate(
+		ctx,
+		filter,
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(computer)
 	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return "", r.unchanged(ctx, computer.ID.Hex(), computer.Version)
+		}
+
 		return "", errors.Wrap(err, "error while updating computer")
 	}
 
-	if res.MatchedCount == 0 {
-		return "", errors.Wrap(mongo.ErrNoDocuments, "not found")
+	return computer.ID.Hex(), nil
+}
+
+// current replaces computer by the stored one, for writes that change
+// nothing but still expect computer.Version.
+func (r *Repository) current(ctx context.Context, computer *Computer) error {
+	stored, err := r.Read(ctx, computer.ID.Hex())
+	if err != nil {
+		return err
 	}
 
-	if res.ModifiedCount == 0 {
-		return "", errors.New("not modified")
+	if computer.Version != 0 && stored.Version != computer.Version {
+		return errs.PreconditionFailed(fmt.Sprintf("computer is at version %d, not %d", stored.Version, computer.Version))
 	}
 
-	if computer.IsDeleted {
-		return "", errors.Wrap(mongo.ErrNoDocuments, "deleted")
+	*computer = *stored
+	return nil
+}
+
+// Owned returns the computers assigned to ownerID, deleted or not.
+func (r *Repository) Owned(ctx context.Context, ownerID string) ([]*Computer, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"ownerId": ownerID})
+	if err != nil {
+		return nil, errors.Wrap(err, "error while finding owned computers")
 	}
 
-	return computer.ID.Hex(), nil
+	var res []*Computer
+	if err := cursor.All(ctx, &res); err != nil {
+		return nil, errors.Wrap(err, "error while decoding owned computers")
+	}
+
+	return res, nil
 }
 
-func (r *Repository) Delete(ctx context.Context, compID string) (string, error) {
-	objID, err := primitive.ObjectIDFromHex(compID)
+// SetOwner assigns the computer, deleted or not, to ownerID, or unassigns
+// it if ownerID is empty, if it still has version or regardless of its
+// version when that is zero. It returns the stored result.
+func (r *Repository) SetOwner(ctx context.Context, compID, ownerID string, version int) (*Computer, error) {
+	objID, err := parseID(compID)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"_id": objID}
+	if version != 0 {
+		filter["version"] = version
+	}
+
+	update := bson.M{"$set": bson.M{"ownerId": ownerID, "updatedAt": time.Now().UTC()}, "$inc": bson.M{"version": 1}}
+	if ownerID == "" {
+		update = bson.M{
+			"$set":   bson.M{"updatedAt": time.Now().UTC()},
+			"$unset": bson.M{"ownerId": ""},
+			"$inc":   bson.M{"version": 1},
+		}
+	}
+
+	var res Computer
+	err = r.collection.FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&res)
+	if err == mongo.ErrNoDocuments {
+		stored, err := r.find(ctx, compID)
+		if err != nil {
+			return nil, err
+		}
+		return nil, errs.PreconditionFailed(fmt.Sprintf("computer is at version %d, not %d", stored.Version, version))
+	}
 	if err != nil {
-		return "", errors.Wrap(err, "error while parsing object id")
+		return nil, errors.Wrap(err, "error while assigning computer")
+	}
+
+	return &res, nil
+}
+
+// Delete flags the computer as deleted by deletedBy, keeping it for
+// restoring until it is purged.
+func (r *Repository) Delete(ctx context.Context, compID, deletedBy string) (string, error) {
+	objID, err := parseID(compID)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	set := bson.M{"isDeleted": true, "deletedAt": now, "updatedAt": now}
+	if deletedBy != "" {
+		set["deletedBy"] = deletedBy
 	}
 
 	if err := r.collection.FindOneAndUpdate(
 		ctx,
 		bson.M{"_id": objID, "isDeleted": false},
-		bson.M{"$set": bson.M{"isDeleted": true}},
+		bson.M{"$set": set, "$inc": bson.M{"version": 1}},
 	).Err(); err != nil {
 		if err == mongo.ErrNoDocuments {
-			return "", errors.Wrap(err, "not found")
+			return "", r.unchanged(ctx, compID, 0)
 		}
 
 		return "", errors.Wrap(err, "error while deleting computer")
@@ -131,16 +319,206 @@ func (r *Repository) Delete(ctx context.Context, compID string) (string, error)
 	return compID, nil
 }
 
-func (r *Repository) GetAll(ctx context.Context) ([]*Computer, error) {
-	var res []*Computer
-	cursor, err := r.collection.Find(ctx, bson.M{"isDeleted": false})
+// Restore undoes the deletion of the computer. It is a conflict if the
+// computer is not deleted.
+func (r *Repository) Restore(ctx context.Context, compID string) (*Computer, error) {
+	objID, err := parseID(compID)
+	if err != nil {
+		return nil, err
+	}
+
+	var res Computer
+	err = r.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": objID, "isDeleted": true},
+		bson.M{
+			"$set":   bson.M{"isDeleted": false, "updatedAt": time.Now().UTC()},
+			"$unset": bson.M{"deletedAt": "", "deletedBy": ""},
+			"$inc":   bson.M{"version": 1},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&res)
+	if err == mongo.ErrNoDocuments {
+		if _, err := r.find(ctx, compID); err != nil {
+			return nil, err
+		}
+		return nil, errs.Conflict("computer is not deleted")
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error while restoring computer")
+	}
+
+	return &res, nil
+}
+
+// Purge removes the computer for good, deleted or not.
+func (r *Repository) Purge(ctx context.Context, compID string) error {
+	objID, err := parseID(compID)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.collection.DeleteOne(ctx, bson.M{"_id": objID})
+	if err != nil {
+		return errors.Wrap(err, "error while purging computer")
+	}
+
+	if res.DeletedCount == 0 {
+		return errs.NotFound("computer not found")
+	}
+
+	return nil
+}
+
+// PurgeDeleted removes up to limit computers deleted before before, oldest
+// first, and returns them.
+func (r *Repository) PurgeDeleted(ctx context.Context, before time.Time, limit int) ([]*Computer, error) {
+	filter := bson.M{"isDeleted": true, "deletedAt": bson.M{"$lt": before}}
+
+	cursor, err := r.collection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "deletedAt", Value: 1}}).
+		SetLimit(int64(limit)))
+	if err != nil {
+		return nil, errors.Wrap(err, "error while finding deleted computers")
+	}
+
+	var found []*Computer
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, errors.Wrap(err, "error while decoding deleted computers")
+	}
+
+	if len(found) == 0 {
+		return nil, nil
+	}
+
+	objIDs := make([]primitive.ObjectID, len(found))
+	for i, c := range found {
+		objIDs[i] = *c.ID
+	}
+
+	// The filter is repeated so computers restored meanwhile are kept.
+	filter["_id"] = bson.M{"$in": objIDs}
+	if _, err := r.collection.DeleteMany(ctx, filter); err != nil {
+		return nil, errors.Wrap(err, "error while purging deleted computers")
+	}
+
+	return found, nil
+}
+
+// unchanged explains why a guarded write matched nothing: the computer is
+// absent, already deleted or, if version is set, at another version.
+func (r *Repository) unchanged(ctx context.Context, compID string, version int) error {
+	objID, err := parseID(compID)
+	if err != nil {
+		return err
+	}
+
+	if err := r.current(ctx, &Computer{ID: &objID, Version: version}); err != nil {
+		return err
+	}
+	return errors.New("computer was not changed")
+}
+
+func parseID(compID string) (primitive.ObjectID, error) {
+	objID, err := primitive.ObjectIDFromHex(compID)
+	if err != nil {
+		return objID, errs.Wrap(errs.KindValidation, err, "invalid computer id")
+	}
+	return objID, nil
+}
+
+func (r *Repository) List(ctx context.Context, params *ListParams) (*Page, error) {
+	field, ok := sortFields[params.SortBy]
+	if !ok {
+		return nil, errs.Validation("unknown sort field: " + params.SortBy)
+	}
+
+	filter := bson.M{"isDeleted": false}
+	if params.Manufacturer != "" {
+		filter["manufacturer"] = params.Manufacturer
+	}
+	if params.OS != "" {
+		filter["os"] = params.OS
+	}
+	if params.CPU != "" {
+		filter["cpu"] = params.CPU
+	}
+	if params.IPPrefix != "" {
+		filter["ip"] = bson.M{"$regex": "^" + regexp.QuoteMeta(params.IPPrefix)}
+	}
+	if params.OwnerID != "" {
+		filter["ownerId"] = params.OwnerID
+	}
+
+	order, cmp := 1, "$gt"
+	if params.SortDesc {
+		order, cmp = -1, "$lt"
+	}
+
+	if params.Cursor != "" {
+		c, err := decodeCursor(params.Cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		if field == "_id" {
+			filter["_id"] = bson.M{cmp: c.ID}
+		} else {
+			filter["$or"] = bson.A{
+				bson.M{field: bson.M{cmp: c.Value}},
+				bson.M{field: c.Value, "_id": bson.M{cmp: c.ID}},
+			}
+		}
+	}
+
+	sort := bson.D{{Key: "_id", Value: order}}
+	if field != "_id" {
+		sort = append(bson.D{{Key: field, Value: order}}, sort...)
+	}
+
+	// One extra document tells us whether there is a next page.
+	opts := options.Find().SetSort(sort).SetLimit(int64(params.Limit + 1))
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
 	if err != nil {
 		return nil, errors.Wrap(err, "error while finding computers")
 	}
 
+	res := make([]*Computer, 0, params.Limit+1)
 	if err = cursor.All(ctx, &res); err != nil {
 		return nil, errors.Wrap(err, "error while decoding computers")
 	}
 
-	return res, nil
+	page := &Page{Items: res}
+	if len(res) > params.Limit {
+		page.Items = res[:params.Limit]
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = encodeCursor(pageCursor{Value: last.sortValue(params.SortBy), ID: *last.ID})
+	}
+
+	return page, nil
+}
+
+type pageCursor struct {
+	Value string             `json:"v,omitempty"`
+	ID    primitive.ObjectID `json:"id"`
+}
+
+func encodeCursor(c pageCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(token string) (*pageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errs.Wrap(errs.KindValidation, err, "invalid cursor")
+	}
+
+	var c pageCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, errs.Wrap(errs.KindValidation, err, "invalid cursor")
+	}
+
+	return &c, nil
 }
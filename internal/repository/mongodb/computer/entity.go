@@ -1,15 +1,139 @@
 package computer
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"practice/internal/pkg/errs"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type Computer struct {
 	ID           *primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
-	IP           string              `json:"ip" bson:"ip"`
-	Manufacturer string              `json:"manufacturer" bson:"manufacturer"`
-	CPU          string              `json:"cpu" bson:"cpu"`
-	RAM          string              `json:"ram" bson:"ram"`
-	HDD          string              `json:"hdd" bson:"hdd"`
-	GPU          string              `json:"gpu" bson:"gpu"`
-	OS           string              `json:"os" bson:"os"`
+	IP           string              `json:"ip" bson:"ip" validate:"required,ip"`
+	Manufacturer string              `json:"manufacturer" bson:"manufacturer" validate:"required"`
+	CPU          string              `json:"cpu" bson:"cpu" validate:"required"`
+	RAM          string              `json:"ram" bson:"ram" validate:"required"`
+	HDD          string              `json:"hdd" bson:"hdd" validate:"required"`
+	GPU          string              `json:"gpu" bson:"gpu" validate:"required"`
+	OS           string              `json:"os" bson:"os" validate:"required,oneof=Windows Linux macOS FreeBSD ChromeOS"`
 	IsDeleted    bool                `json:"isDeleted" bson:"isDeleted"`
+	// OwnerID is the id of the user the computer is assigned to, if any.
+	// Users are kept in Postgres, so nothing but the services keeps it
+	// pointing at one that is not deleted.
+	OwnerID string `json:"ownerId,omitempty" bson:"ownerId,omitempty" validate:"uuid"`
+	// Version counts the writes to the computer. An update carrying a
+	// non-zero version only applies to that version.
+	Version int `json:"version" bson:"version"`
+	// DeletedAt and DeletedBy tell when and by whom a deleted computer was
+	// deleted.
+	DeletedAt *time.Time `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	DeletedBy string     `json:"deletedBy,omitempty" bson:"deletedBy,omitempty"`
+	// CreatedAt and UpdatedAt are set by the repository. Updates include
+	// deleting and restoring.
+	CreatedAt *time.Time `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+}
+
+// Patch is a partial update: Computer holds the merged result, of which
+// only Fields, named by their JSON names, are written.
+type Patch struct {
+	Computer
+	Fields []string `json:"fields"`
+}
+
+// patchFields maps the fields a Patch may write to document fields.
+var patchFields = map[string]string{
+	"ip":           "ip",
+	"manufacturer": "manufacturer",
+	"cpu":          "cpu",
+	"ram":          "ram",
+	"hdd":          "hdd",
+	"gpu":          "gpu",
+	"os":           "os",
+	"ownerId":      "ownerId",
+}
+
+// CheckFields rejects fields that do not exist or cannot be patched.
+func (p *Patch) CheckFields() error {
+	var invalid []errs.FieldError
+	for _, f := range p.Fields {
+		if _, ok := patchFields[f]; !ok {
+			invalid = append(invalid, errs.FieldError{Field: f, Message: "cannot be patched"})
+		}
+	}
+
+	if len(invalid) > 0 {
+		return errs.Invalid("invalid patch", invalid...)
+	}
+	return nil
+}
+
+// ListParams describes one page of the computer listing. Cursor is the
+// opaque token returned as Page.NextCursor by the previous call.
+type ListParams struct {
+	Limit    int
+	Cursor   string
+	SortBy   string
+	SortDesc bool
+
+	Manufacturer string
+	OS           string
+	CPU          string
+	IPPrefix     string
+	OwnerID      string
+}
+
+type Page struct {
+	Items      []*Computer `json:"items"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+}
+
+// sortFields maps the sort keys accepted by List to document fields.
+var sortFields = map[string]string{
+	"id":           "_id",
+	"ip":           "ip",
+	"manufacturer": "manufacturer",
+	"cpu":          "cpu",
+	"os":           "os",
+}
+
+func IsSortable(field string) bool {
+	_, ok := sortFields[field]
+	return ok
+}
+
+func (c *Computer) patchValue(field string) any {
+	switch field {
+	case "ip":
+		return c.IP
+	case "manufacturer":
+		return c.Manufacturer
+	case "cpu":
+		return c.CPU
+	case "ram":
+		return c.RAM
+	case "hdd":
+		return c.HDD
+	case "gpu":
+		return c.GPU
+	case "os":
+		return c.OS
+	case "ownerId":
+		return c.OwnerID
+	}
+	return nil
+}
+
+func (c *Computer) sortValue(field string) string {
+	switch field {
+	case "ip":
+		return c.IP
+	case "manufacturer":
+		return c.Manufacturer
+	case "cpu":
+		return c.CPU
+	case "os":
+		return c.OS
+	}
+	return ""
 }
@@ -6,6 +6,7 @@ import (
 	"practice/internal/pkg/config"
 
 	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/fx"
@@ -63,6 +64,18 @@ func (r *MongoDB) onStart(ctx context.Context) error {
 	r.Client = connect
 	r.DB = r.Client.Database(r.Cfg.MongoDB_NAME)
 
+	var hello bson.M
+	if err := r.DB.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return errors.Wrap(err, "error while inspecting mongodb topology")
+	}
+
+	// Entities, outbox rows and processed message ids are written together,
+	// which standalone servers cannot do atomically.
+	_, replicaSet := hello["setName"]
+	if !replicaSet && hello["msg"] != "isdbgrid" {
+		return errors.New("mongodb is standalone: transactions need a replica set or a sharded cluster")
+	}
+
 	r.Logger.Info("connected to mongodb")
 	return nil
 }
@@ -70,3 +83,23 @@ func (r *MongoDB) onStart(ctx context.Context) error {
 func (r *MongoDB) onStop(ctx context.Context) error {
 	return r.Client.Disconnect(ctx)
 }
+
+// Tx runs fn inside a multi-document transaction; collection calls made
+// with the ctx passed to fn take part in it. fn may be retried on transient
+// errors. Nested calls join the outer transaction.
+func (r *MongoDB) Tx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	session, err := r.Client.StartSession()
+	if err != nil {
+		return errors.Wrap(err, "error while starting session")
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (any, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
@@ -0,0 +1,158 @@
+package outbox
+
+import (
+	"context"
+	"log/slog"
+	"practice/internal/pkg/config"
+	"practice/internal/pkg/outbox"
+	"practice/internal/repository/mongodb"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/fx"
+)
+
+var Module = fx.Provide(New)
+
+// RepositoryOutbox stores messages for MongoDB-backed aggregates.
+type RepositoryOutbox interface {
+	outbox.Store
+}
+
+type Repository struct {
+	repo       *mongodb.MongoDB
+	collection *mongo.Collection
+	logger     *slog.Logger
+}
+
+type Options struct {
+	fx.In
+	fx.Lifecycle
+	Cfg    *config.Config
+	Mongo  *mongodb.MongoDB
+	Logger *slog.Logger
+}
+
+var _ RepositoryOutbox = (*Repository)(nil)
+
+func New(opts Options) RepositoryOutbox {
+	repo := &Repository{
+		logger: opts.Logger,
+	}
+
+	opts.Lifecycle.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			repo.repo = opts.Mongo
+			repo.collection = repo.repo.DB.Collection(opts.Cfg.MongoDB_OUTBOX_COLLECTION)
+
+			_, err := repo.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{{Key: "sentAt", Value: 1}, {Key: "nextAttemptAt", Value: 1}},
+			})
+			return errors.Wrap(err, "error while creating outbox index")
+		},
+		OnStop: func(context.Context) error { return nil },
+	})
+
+	return repo
+}
+
+func (r *Repository) Add(ctx context.Context, msg *outbox.Message) error {
+	if msg.ID == "" {
+		msg.ID = uuid.NewString()
+	}
+
+	now := time.Now().UTC()
+	msg.CreatedAt = now
+	msg.NextAttemptAt = now
+
+	if _, err := r.collection.InsertOne(ctx, msg); err != nil {
+		return errors.Wrap(err, "error while inserting outbox message")
+	}
+
+	return nil
+}
+
+func (r *Repository) Claim(ctx context.Context, limit, maxAttempts int, lease time.Duration) ([]*outbox.Message, error) {
+	var res []*outbox.Message
+
+	for len(res) < limit {
+		now := time.Now().UTC()
+
+		var msg outbox.Message
+		err := r.collection.FindOneAndUpdate(
+			ctx,
+			bson.M{
+				"sentAt":        nil,
+				"nextAttemptAt": bson.M{"$lte": now},
+				"attempts":      bson.M{"$lt": maxAttempts},
+			},
+			bson.M{"$set": bson.M{"nextAttemptAt": now.Add(lease)}},
+			options.FindOneAndUpdate().SetSort(bson.D{{Key: "createdAt", Value: 1}}),
+		).Decode(&msg)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				break
+			}
+			return res, errors.Wrap(err, "error while claiming outbox message")
+		}
+
+		res = append(res, &msg)
+	}
+
+	return res, nil
+}
+
+func (r *Repository) MarkSent(ctx context.Context, id string) error {
+	_, err := r.collection.UpdateByID(ctx, id, bson.M{
+		"$set": bson.M{"sentAt": time.Now().UTC(), "lastError": ""},
+		"$inc": bson.M{"attempts": 1},
+	})
+	return errors.Wrap(err, "error while marking outbox message sent")
+}
+
+func (r *Repository) PurgeSent(ctx context.Context, before time.Time, limit int) (int, error) {
+	cursor, err := r.collection.Find(ctx,
+		bson.M{"sentAt": bson.M{"$lt": before}},
+		options.Find().
+			SetSort(bson.D{{Key: "sentAt", Value: 1}}).
+			SetLimit(int64(limit)).
+			SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return 0, errors.Wrap(err, "error while finding sent outbox messages")
+	}
+
+	var sent []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &sent); err != nil {
+		return 0, errors.Wrap(err, "error while decoding sent outbox messages")
+	}
+	if len(sent) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]string, 0, len(sent))
+	for _, s := range sent {
+		ids = append(ids, s.ID)
+	}
+
+	res, err := r.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, errors.Wrap(err, "error while purging sent outbox messages")
+	}
+
+	return int(res.DeletedCount), nil
+}
+
+func (r *Repository) MarkFailed(ctx context.Context, id string, cause string, retryAt time.Time) error {
+	_, err := r.collection.UpdateByID(ctx, id, bson.M{
+		"$set": bson.M{"lastError": cause, "nextAttemptAt": retryAt},
+		"$inc": bson.M{"attempts": 1},
+	})
+	return errors.Wrap(err, "error while marking outbox message failed")
+}
@@ -0,0 +1,79 @@
+package processed
+
+import (
+	"context"
+	"log/slog"
+	"practice/internal/pkg/config"
+	"practice/internal/pkg/dedup"
+	"practice/internal/repository/mongodb"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/fx"
+)
+
+var Module = fx.Provide(New)
+
+// RepositoryProcessed records the async commands applied to MongoDB. Ids
+// expire through a TTL index.
+type RepositoryProcessed interface {
+	dedup.Store
+}
+
+type Repository struct {
+	repo       *mongodb.MongoDB
+	collection *mongo.Collection
+	logger     *slog.Logger
+}
+
+type Options struct {
+	fx.In
+	fx.Lifecycle
+	Cfg    *config.Config
+	Mongo  *mongodb.MongoDB
+	Logger *slog.Logger
+}
+
+type processedMessage struct {
+	ID          string    `bson:"_id"`
+	ProcessedAt time.Time `bson:"processedAt"`
+}
+
+var _ RepositoryProcessed = (*Repository)(nil)
+
+func New(opts Options) RepositoryProcessed {
+	repo := &Repository{
+		logger: opts.Logger,
+	}
+
+	opts.Lifecycle.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			repo.repo = opts.Mongo
+			repo.collection = repo.repo.DB.Collection(opts.Cfg.MongoDB_PROCESSED_COLLECTION)
+
+			_, err := repo.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "processedAt", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(int32(opts.Cfg.PROCESSED_MESSAGES_TTL.Seconds())),
+			})
+			return errors.Wrap(err, "error while creating processed messages index")
+		},
+		OnStop: func(context.Context) error { return nil },
+	})
+
+	return repo
+}
+
+func (r *Repository) Add(ctx context.Context, id string) error {
+	_, err := r.collection.InsertOne(ctx, processedMessage{
+		ID:          id,
+		ProcessedAt: time.Now().UTC(),
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return dedup.ErrDuplicate
+	}
+
+	return errors.Wrap(err, "error while recording processed message")
+}
@@ -0,0 +1,172 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"practice/internal/pkg/audit"
+	"practice/internal/pkg/config"
+	"practice/internal/repository/postgres"
+
+	"github.com/pkg/errors"
+	"go.uber.org/fx"
+)
+
+var Module = fx.Provide(New)
+
+// RepositoryAudit keeps the history of Postgres-backed entities.
+type RepositoryAudit interface {
+	audit.Store
+}
+
+type Repository struct {
+	repo   *postgres.Postgres
+	logger *slog.Logger
+}
+
+type Options struct {
+	fx.In
+	fx.Lifecycle
+	Cfg      *config.Config
+	Postgres *postgres.Postgres
+	Logger   *slog.Logger
+}
+
+var _ RepositoryAudit = (*Repository)(nil)
+
+func New(opts Options) RepositoryAudit {
+	repo := &Repository{
+		logger: opts.Logger,
+	}
+
+	opts.Lifecycle.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			repo.repo = opts.Postgres
+			return nil
+		},
+		OnStop: func(context.Context) error { return nil },
+	})
+
+	return repo
+}
+
+func (r *Repository) Add(ctx context.Context, entry *audit.Entry) error {
+	before, err := snapshot(entry.Before)
+	if err != nil {
+		return err
+	}
+	after, err := snapshot(entry.After)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	insert into audit_log
+		(id, entity, entity_id, action, version, before, after, actor, source, request_id, message_id, changed_at)
+	values
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+
+	_, err = r.repo.Conn(ctx).ExecContext(ctx, query,
+		entry.ID, entry.Entity, entry.EntityID, entry.Action, entry.Version, before, after,
+		entry.Actor, entry.Source, entry.RequestID, entry.MessageID, entry.ChangedAt,
+	)
+	if err != nil {
+		return postgres.WrapError(err, "error while inserting audit entry")
+	}
+
+	return nil
+}
+
+func (r *Repository) List(ctx context.Context, entity, entityID string, params *audit.ListParams) (*audit.Page, error) {
+	args := []any{entity, entityID}
+	where := "entity = $1 and entity_id = $2"
+
+	if params.Cursor != "" {
+		c, err := audit.DecodeCursor(params.Cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, c.ChangedAt, c.ID)
+		where += " and (changed_at, id) < ($3, $4)"
+	}
+
+	// One extra row tells us whether there is a next page.
+	args = append(args, params.Limit+1)
+	query := `
+	select
+		id, action, version, before, after, actor, source, request_id, message_id, changed_at
+	from
+		audit_log
+	where
+		` + where + `
+	order by
+		changed_at desc, id desc
+	limit ` + fmt.Sprintf("$%d", len(args))
+
+	rows, err := r.repo.Conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, postgres.WrapError(err, "error while listing audit entries")
+	}
+	defer rows.Close()
+
+	res := make([]*audit.Entry, 0, params.Limit+1)
+	for rows.Next() {
+		var (
+			e             = audit.Entry{Entity: entity, EntityID: entityID}
+			before, after []byte
+		)
+		err := rows.Scan(&e.ID, &e.Action, &e.Version, &before, &after,
+			&e.Actor, &e.Source, &e.RequestID, &e.MessageID, &e.ChangedAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "error while scanning audit entry")
+		}
+
+		if e.Before, err = decodeSnapshot(before); err != nil {
+			return nil, err
+		}
+		if e.After, err = decodeSnapshot(after); err != nil {
+			return nil, err
+		}
+		res = append(res, &e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error while listing audit entries")
+	}
+
+	page := &audit.Page{Items: res}
+	if len(res) > params.Limit {
+		page.Items = res[:params.Limit]
+		page.NextCursor = audit.NextCursor(page.Items[len(page.Items)-1])
+	}
+
+	return page, nil
+}
+
+// snapshot encodes s for a JSONB column, as NULL when there is none.
+func snapshot(s map[string]any) (any, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "error while encoding audit snapshot")
+	}
+	return string(b), nil
+}
+
+func decodeSnapshot(b []byte) (map[string]any, error) {
+	if b == nil {
+		return nil, nil
+	}
+
+	var s map[string]any
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, errors.Wrap(err, "error while decoding audit snapshot")
+	}
+	return s, nil
+}
@@ -0,0 +1,126 @@
+package command
+
+import (
+	"context"
+	"log/slog"
+	"practice/internal/pkg/command"
+	"practice/internal/pkg/config"
+	"practice/internal/repository/postgres"
+
+	"go.uber.org/fx"
+)
+
+var Module = fx.Provide(New)
+
+// RepositoryCommand tracks async commands on Postgres-backed aggregates.
+type RepositoryCommand interface {
+	command.Store
+}
+
+type Repository struct {
+	repo   *postgres.Postgres
+	logger *slog.Logger
+}
+
+type Options struct {
+	fx.In
+	fx.Lifecycle
+	Cfg      *config.Config
+	Postgres *postgres.Postgres
+	Logger   *slog.Logger
+}
+
+var _ RepositoryCommand = (*Repository)(nil)
+
+func New(opts Options) RepositoryCommand {
+	repo := &Repository{
+		logger: opts.Logger,
+	}
+
+	opts.Lifecycle.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			repo.repo = opts.Postgres
+			return nil
+		},
+		OnStop: func(context.Context) error { return nil },
+	})
+
+	return repo
+}
+
+func (r *Repository) Add(ctx context.Context, cmd *command.Command) error {
+	cmd.Status = command.StatusPending
+
+	query := `
+	insert into commands
+		(id, type, status)
+	values
+		($1, $2, $3)
+	returning created_at, updated_at
+	`
+
+	err := r.repo.Conn(ctx).QueryRowContext(ctx, query, cmd.ID, cmd.Type, cmd.Status).
+		Scan(&cmd.CreatedAt, &cmd.UpdatedAt)
+	if err != nil {
+		return postgres.WrapError(err, "error while inserting command")
+	}
+
+	return nil
+}
+
+func (r *Repository) Get(ctx context.Context, id string) (*command.Command, error) {
+	query := `
+	select
+		id, type, status, entity_id, error, created_at, updated_at
+	from
+		commands
+	where
+		id = $1
+	`
+
+	var cmd command.Command
+	err := r.repo.Conn(ctx).QueryRowContext(ctx, query, id).Scan(
+		&cmd.ID, &cmd.Type, &cmd.Status, &cmd.EntityID, &cmd.Error, &cmd.CreatedAt, &cmd.UpdatedAt,
+	)
+	if err != nil {
+		return nil, postgres.WrapError(err, "error while finding command")
+	}
+
+	return &cmd, nil
+}
+
+func (r *Repository) Succeed(ctx context.Context, id, entityID string) error {
+	query := `
+	insert into commands
+		(id, status, entity_id)
+	values
+		($1, $2, $3)
+	on conflict (id) do update set
+		status = excluded.status, entity_id = excluded.entity_id, error = '', updated_at = now()
+	`
+
+	if _, err := r.repo.Conn(ctx).ExecContext(ctx, query, id, command.StatusSucceeded, entityID); err != nil {
+		return postgres.WrapError(err, "error while marking command succeeded")
+	}
+
+	return nil
+}
+
+func (r *Repository) Fail(ctx context.Context, id, cause string) error {
+	query := `
+	insert into commands
+		(id, status, error)
+	values
+		($1, $2, $3)
+	on conflict (id) do update set
+		status = excluded.status, error = excluded.error, updated_at = now()
+	where
+		commands.status <> $4
+	`
+
+	if _, err := r.repo.Conn(ctx).ExecContext(ctx, query, id, command.StatusFailed, cause, command.StatusSucceeded); err != nil {
+		return postgres.WrapError(err, "error while marking command failed")
+	}
+
+	return nil
+}
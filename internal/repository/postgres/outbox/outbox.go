@@ -0,0 +1,204 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"practice/internal/pkg/config"
+	"practice/internal/pkg/outbox"
+	"practice/internal/repository/postgres"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.uber.org/fx"
+)
+
+var Module = fx.Provide(New)
+
+// RepositoryOutbox stores messages for Postgres-backed aggregates.
+type RepositoryOutbox interface {
+	outbox.Store
+}
+
+type Repository struct {
+	repo   *postgres.Postgres
+	logger *slog.Logger
+}
+
+type Options struct {
+	fx.In
+	fx.Lifecycle
+	Cfg      *config.Config
+	Postgres *postgres.Postgres
+	Logger   *slog.Logger
+}
+
+var _ RepositoryOutbox = (*Repository)(nil)
+
+func New(opts Options) RepositoryOutbox {
+	repo := &Repository{
+		logger: opts.Logger,
+	}
+
+	opts.Lifecycle.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			repo.repo = opts.Postgres
+			return nil
+		},
+		OnStop: func(context.Context) error { return nil },
+	})
+
+	return repo
+}
+
+func (r *Repository) Add(ctx context.Context, msg *outbox.Message) error {
+	if msg.ID == "" {
+		msg.ID = uuid.NewString()
+	}
+
+	headers, err := json.Marshal(msg.Headers)
+	if err != nil {
+		return errors.Wrap(err, "error while encoding headers")
+	}
+
+	query := `
+	insert into outbox
+		(id, transport, topic, msg_key, headers, payload)
+	values
+		($1, $2, $3, $4, $5, $6)
+	returning created_at, next_attempt_at
+	`
+
+	err = r.repo.Conn(ctx).QueryRowContext(ctx, query,
+		msg.ID, msg.Transport, msg.Topic, msg.Key, headers, msg.Payload,
+	).Scan(&msg.CreatedAt, &msg.NextAttemptAt)
+	if err != nil {
+		return postgres.WrapError(err, "error while inserting outbox message")
+	}
+
+	return nil
+}
+
+func (r *Repository) Claim(ctx context.Context, limit, maxAttempts int, lease time.Duration) ([]*outbox.Message, error) {
+	query := `
+	update
+		outbox
+	set
+		next_attempt_at = now() + make_interval(secs => $3)
+	where
+		id in (
+			select
+				id
+			from
+				outbox
+			where
+				sent_at is null and next_attempt_at <= now() and attempts < $2
+			order by
+				created_at
+			limit $1
+			for update skip locked
+		)
+	returning
+		id, transport, topic, msg_key, headers, payload, attempts, last_error, created_at, next_attempt_at
+	`
+
+	rows, err := r.repo.Conn(ctx).QueryContext(ctx, query, limit, maxAttempts, lease.Seconds())
+	if err != nil {
+		return nil, postgres.WrapError(err, "error while claiming outbox messages")
+	}
+	defer rows.Close()
+
+	var res []*outbox.Message
+	for rows.Next() {
+		var (
+			msg     outbox.Message
+			headers []byte
+		)
+
+		if err := rows.Scan(
+			&msg.ID, &msg.Transport, &msg.Topic, &msg.Key, &headers, &msg.Payload,
+			&msg.Attempts, &msg.LastError, &msg.CreatedAt, &msg.NextAttemptAt,
+		); err != nil {
+			return nil, errors.Wrap(err, "error while scanning outbox message")
+		}
+
+		if err := json.Unmarshal(headers, &msg.Headers); err != nil {
+			return nil, errors.Wrap(err, "error while decoding headers")
+		}
+
+		res = append(res, &msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, postgres.WrapError(err, "error while claiming outbox messages")
+	}
+
+	return res, nil
+}
+
+func (r *Repository) MarkSent(ctx context.Context, id string) error {
+	query := `
+	update
+		outbox
+	set
+		sent_at = now(), attempts = attempts + 1, last_error = ''
+	where
+		id = $1
+	`
+
+	if _, err := r.repo.Conn(ctx).ExecContext(ctx, query, id); err != nil {
+		return postgres.WrapError(err, "error while marking outbox message sent")
+	}
+
+	return nil
+}
+
+func (r *Repository) PurgeSent(ctx context.Context, before time.Time, limit int) (int, error) {
+	query := `
+	delete from
+		outbox
+	where
+		id in (
+			select
+				id
+			from
+				outbox
+			where
+				sent_at < $1
+			order by
+				sent_at
+			limit $2
+			for update skip locked
+		)
+	`
+
+	res, err := r.repo.Conn(ctx).ExecContext(ctx, query, before, limit)
+	if err != nil {
+		return 0, postgres.WrapError(err, "error while purging sent outbox messages")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "error while purging sent outbox messages")
+	}
+
+	return int(n), nil
+}
+
+func (r *Repository) MarkFailed(ctx context.Context, id string, cause string, retryAt time.Time) error {
+	query := `
+	update
+		outbox
+	set
+		attempts = attempts + 1, last_error = $2, next_attempt_at = $3
+	where
+		id = $1
+	`
+
+	if _, err := r.repo.Conn(ctx).ExecContext(ctx, query, id, cause, retryAt); err != nil {
+		return postgres.WrapError(err, "error while marking outbox message failed")
+	}
+
+	return nil
+}
@@ -6,8 +6,9 @@ import (
 	"fmt"
 	"log/slog"
 	"practice/internal/pkg/config"
+	"practice/internal/pkg/errs"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	"go.uber.org/fx"
 )
@@ -25,6 +26,15 @@ type Options struct {
 	Logger *slog.Logger
 }
 
+// Querier is the subset of *sql.DB and *sql.Tx used by repositories.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type txKey struct{}
+
 var Module = fx.Options(fx.Provide(New))
 
 func New(opts Options) *Postgres {
@@ -73,6 +83,55 @@ func (r *Postgres) onStop(ctx context.Context) error {
 	return r.DB.Close()
 }
 
+// Conn returns the transaction started by Tx for ctx, or the pool when ctx
+// carries none. Repositories must use it so that they join open transactions.
+func (r *Postgres) Conn(ctx context.Context) Querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return r.DB
+}
+
+// Tx runs fn inside a transaction that is committed when fn returns nil and
+// rolled back otherwise. Nested calls join the outer transaction.
+func (r *Postgres) Tx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "error while beginning transaction")
+	}
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return errors.Wrap(tx.Commit(), "error while committing transaction")
+}
+
+// WrapError wraps err with msg, classifying no-rows, unique violations and
+// malformed input so callers get the matching errs kind.
+func WrapError(err error, msg string) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return errs.Wrap(errs.KindNotFound, err, msg)
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "23505": // unique_violation
+			return errs.Wrap(errs.KindConflict, err, msg)
+		case "22P02": // invalid_text_representation
+			return errs.Wrap(errs.KindValidation, err, msg)
+		}
+	}
+
+	return errors.Wrap(err, msg)
+}
+
 func migrateDB(ctx context.Context, db *sql.DB) error {
 	tx, err := db.Begin()
 	if err != nil {
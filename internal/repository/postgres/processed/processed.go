@@ -0,0 +1,127 @@
+package processed
+
+import (
+	"context"
+	"log/slog"
+	"practice/internal/pkg/config"
+	"practice/internal/pkg/dedup"
+	"practice/internal/repository/postgres"
+	"sync"
+	"time"
+
+	"go.uber.org/fx"
+)
+
+// purgeInterval is how often expired ids are deleted. Postgres has no TTL
+// indexes, so the repository purges them itself.
+const purgeInterval = time.Hour
+
+var Module = fx.Provide(New)
+
+// RepositoryProcessed records the async commands applied to Postgres.
+type RepositoryProcessed interface {
+	dedup.Store
+}
+
+type Repository struct {
+	repo   *postgres.Postgres
+	logger *slog.Logger
+	ttl    time.Duration
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type Options struct {
+	fx.In
+	fx.Lifecycle
+	Cfg      *config.Config
+	Postgres *postgres.Postgres
+	Logger   *slog.Logger
+}
+
+var _ RepositoryProcessed = (*Repository)(nil)
+
+func New(opts Options) RepositoryProcessed {
+	repo := &Repository{
+		logger: opts.Logger,
+		ttl:    opts.Cfg.PROCESSED_MESSAGES_TTL,
+	}
+
+	opts.Lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			repo.repo = opts.Postgres
+
+			ctx, cancel := context.WithCancel(context.Background())
+			repo.cancel = cancel
+
+			repo.wg.Add(1)
+			go repo.purgeLoop(ctx)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			repo.cancel()
+			repo.wg.Wait()
+			return nil
+		},
+	})
+
+	return repo
+}
+
+func (r *Repository) Add(ctx context.Context, id string) error {
+	query := `
+	insert into processed_messages
+		(id)
+	values
+		($1)
+	on conflict (id) do nothing
+	`
+
+	res, err := r.repo.Conn(ctx).ExecContext(ctx, query, id)
+	if err != nil {
+		return postgres.WrapError(err, "error while recording processed message")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return postgres.WrapError(err, "error while recording processed message")
+	}
+	if n == 0 {
+		return dedup.ErrDuplicate
+	}
+
+	return nil
+}
+
+func (r *Repository) purgeLoop(ctx context.Context) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.purge(ctx); err != nil && ctx.Err() == nil {
+				r.logger.Error("error while purging processed messages", "error", err.Error())
+			}
+		}
+	}
+}
+
+func (r *Repository) purge(ctx context.Context) error {
+	query := `
+	delete from
+		processed_messages
+	where
+		processed_at < now() - make_interval(secs => $1)
+	`
+
+	if _, err := r.repo.Conn(ctx).ExecContext(ctx, query, r.ttl.Seconds()); err != nil {
+		return postgres.WrapError(err, "error while purging processed messages")
+	}
+
+	return nil
+}
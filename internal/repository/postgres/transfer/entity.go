@@ -0,0 +1,16 @@
+package transfer
+
+import "time"
+
+// Transfer gives the computers of a deleted user to the user To, or
+// unassigns them when To is empty. Actor and RequestID are those of the
+// deletion, so the changes it makes are attributed to it.
+type Transfer struct {
+	ID        string
+	From      string
+	To        string
+	Actor     string
+	RequestID string
+	Attempts  int
+	CreatedAt time.Time
+}
@@ -0,0 +1,144 @@
+package transfer
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"practice/internal/pkg/config"
+	"practice/internal/repository/postgres"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.uber.org/fx"
+)
+
+var Module = fx.Provide(New)
+
+// RepositoryTransfer queues the ownership transfers of deleted users until
+// they are applied to the computers in MongoDB.
+type RepositoryTransfer interface {
+	// Add must join the transaction carried by ctx.
+	Add(ctx context.Context, transfer *Transfer) error
+	// Next returns the oldest transfer due, or nil if there is none, and
+	// locks it until the transaction carried by ctx ends. Transfers
+	// locked by others are skipped.
+	Next(ctx context.Context) (*Transfer, error)
+	Done(ctx context.Context, id string) error
+	Fail(ctx context.Context, id string, cause string, retryAt time.Time) error
+}
+
+type Repository struct {
+	repo   *postgres.Postgres
+	logger *slog.Logger
+}
+
+type Options struct {
+	fx.In
+	fx.Lifecycle
+	Cfg      *config.Config
+	Postgres *postgres.Postgres
+	Logger   *slog.Logger
+}
+
+var _ RepositoryTransfer = (*Repository)(nil)
+
+func New(opts Options) RepositoryTransfer {
+	repo := &Repository{
+		logger: opts.Logger,
+	}
+
+	opts.Lifecycle.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			repo.repo = opts.Postgres
+			return nil
+		},
+		OnStop: func(context.Context) error { return nil },
+	})
+
+	return repo
+}
+
+func (r *Repository) Add(ctx context.Context, transfer *Transfer) error {
+	if transfer.ID == "" {
+		transfer.ID = uuid.NewString()
+	}
+
+	query := `
+	insert into ownership_transfers
+		(id, from_user_id, to_user_id, actor, request_id)
+	values
+		($1, $2, $3, $4, $5)
+	returning created_at
+	`
+
+	err := r.repo.Conn(ctx).QueryRowContext(ctx, query,
+		transfer.ID, transfer.From, transfer.To, transfer.Actor, transfer.RequestID,
+	).Scan(&transfer.CreatedAt)
+	if err != nil {
+		return postgres.WrapError(err, "error while inserting ownership transfer")
+	}
+
+	return nil
+}
+
+func (r *Repository) Next(ctx context.Context) (*Transfer, error) {
+	query := `
+	select
+		id, from_user_id, to_user_id, actor, request_id, attempts, created_at
+	from
+		ownership_transfers
+	where
+		done_at is null and next_attempt_at <= now()
+	order by
+		next_attempt_at
+	limit 1
+	for update skip locked
+	`
+
+	var t Transfer
+	err := r.repo.Conn(ctx).QueryRowContext(ctx, query).
+		Scan(&t.ID, &t.From, &t.To, &t.Actor, &t.RequestID, &t.Attempts, &t.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, postgres.WrapError(err, "error while finding ownership transfer")
+	}
+
+	return &t, nil
+}
+
+func (r *Repository) Done(ctx context.Context, id string) error {
+	query := `
+	update
+		ownership_transfers
+	set
+		done_at = now(), attempts = attempts + 1, last_error = ''
+	where
+		id = $1
+	`
+
+	if _, err := r.repo.Conn(ctx).ExecContext(ctx, query, id); err != nil {
+		return postgres.WrapError(err, "error while marking ownership transfer done")
+	}
+
+	return nil
+}
+
+func (r *Repository) Fail(ctx context.Context, id string, cause string, retryAt time.Time) error {
+	query := `
+	update
+		ownership_transfers
+	set
+		attempts = attempts + 1, last_error = $2, next_attempt_at = $3
+	where
+		id = $1
+	`
+
+	if _, err := r.repo.Conn(ctx).ExecContext(ctx, query, id, cause, retryAt); err != nil {
+		return postgres.WrapError(err, "error while marking ownership transfer failed")
+	}
+
+	return nil
+}
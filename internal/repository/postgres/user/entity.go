@@ -1,9 +1,114 @@
 package user
 
+import (
+	"practice/internal/pkg/errs"
+	"strconv"
+	"time"
+)
+
 type User struct {
-	ID        string `json:"id"`
-	Name      string `json:"name"`
-	Age       int    `json:"age"`
-	Email     string `json:"email"`
+	ID        string `json:"id" validate:"required,uuid"`
+	Name      string `json:"name" validate:"required,max=50"`
+	Age       int    `json:"age" validate:"required,min=1,max=150"`
+	Email     string `json:"email" validate:"required,email,max=100"`
 	IsDeleted bool   `json:"isDeleted"`
+	// Version counts the writes to the user. An update carrying a non-zero
+	// version only applies to that version.
+	Version int `json:"version"`
+	// DeletedAt and DeletedBy tell when and by whom a deleted user was
+	// deleted.
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	DeletedBy string     `json:"deletedBy,omitempty"`
+	// CreatedAt and UpdatedAt are set by the database. Updates include
+	// deleting and restoring.
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+}
+
+// Patch is a partial update: User holds the merged result, of which only
+// Fields, named by their JSON names, are written.
+type Patch struct {
+	User
+	Fields []string `json:"fields"`
+}
+
+// patchColumns maps the fields a Patch may write to table columns.
+var patchColumns = map[string]string{
+	"name":  "name",
+	"age":   "age",
+	"email": "email",
+}
+
+// CheckFields rejects fields that do not exist or cannot be patched.
+func (p *Patch) CheckFields() error {
+	var invalid []errs.FieldError
+	for _, f := range p.Fields {
+		if _, ok := patchColumns[f]; !ok {
+			invalid = append(invalid, errs.FieldError{Field: f, Message: "cannot be patched"})
+		}
+	}
+
+	if len(invalid) > 0 {
+		return errs.Invalid("invalid patch", invalid...)
+	}
+	return nil
+}
+
+// ListParams describes one page of the user listing. Name and Email are
+// case-insensitive substring filters, MinAge and MaxAge are inclusive and
+// ignored when zero. Cursor is the opaque token returned as Page.NextCursor.
+type ListParams struct {
+	Limit    int
+	Cursor   string
+	SortBy   string
+	SortDesc bool
+
+	Name           string
+	Email          string
+	MinAge         int
+	MaxAge         int
+	IncludeDeleted bool
+}
+
+type Page struct {
+	Items      []*User `json:"items"`
+	Total      int     `json:"total"`
+	NextCursor string  `json:"nextCursor,omitempty"`
+}
+
+// sortColumns maps the sort keys accepted by List to table columns.
+var sortColumns = map[string]string{
+	"id":    "id",
+	"name":  "name",
+	"age":   "age",
+	"email": "email",
+}
+
+func IsSortable(field string) bool {
+	_, ok := sortColumns[field]
+	return ok
+}
+
+func (u *User) patchValue(field string) any {
+	switch field {
+	case "name":
+		return u.Name
+	case "age":
+		return u.Age
+	case "email":
+		return u.Email
+	}
+	return nil
+}
+
+func (u *User) sortValue(field string) string {
+	switch field {
+	case "name":
+		return u.Name
+	case "age":
+		return strconv.Itoa(u.Age)
+	case "email":
+		return u.Email
+	}
+	return ""
 }
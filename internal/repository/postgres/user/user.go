@@ -3,9 +3,15 @@ package user
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"log/slog"
 	"practice/internal/pkg/config"
+	"practice/internal/pkg/errs"
 	"practice/internal/repository/postgres"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"go.uber.org/fx"
@@ -17,7 +23,13 @@ type RepositoryUser interface {
 	Create(ctx context.Context, user *User) (*User, error)
 	Read(ctx context.Context, userID string) (*User, error)
 	Update(ctx context.Context, user *User) (string, error)
-	Delete(ctx context.Context, userID string) (string, error)
+	Patch(ctx context.Context, patch *Patch) (string, error)
+	Find(ctx context.Context, userID string) (*User, error)
+	Delete(ctx context.Context, userID, deletedBy string) (string, error)
+	Restore(ctx context.Context, userID string) (*User, error)
+	Purge(ctx context.Context, userID string) error
+	PurgeDeleted(ctx context.Context, before time.Time, limit int) ([]*User, error)
+	List(ctx context.Context, params *ListParams) (*Page, error)
 }
 
 type Repository struct {
@@ -57,78 +69,412 @@ func (r *Repository) Create(ctx context.Context, user *User) (*User, error) {
 		(id, name, age, email) 
 	values
 		($1, $2, $3, $4)
-	returning *
+	returning
+		version, created_at, updated_at
 	`
 
-	_, err := r.repo.DB.ExecContext(ctx, query, user.ID, user.Name, user.Age, user.Email)
+	err := r.repo.Conn(ctx).QueryRowContext(ctx, query, user.ID, user.Name, user.Age, user.Email).
+		Scan(&user.Version, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
-		return nil, errors.Wrap(err, "error while inserting user")
+		return nil, postgres.WrapError(err, "error while inserting user")
 	}
 
 	return user, nil
 }
 
 func (r *Repository) Read(ctx context.Context, userID string) (*User, error) {
+	u, err := r.find(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.IsDeleted {
+		return nil, errs.AlreadyDeleted("user is deleted")
+	}
+
+	return u, nil
+}
+
+// Find returns the user, deleted or not, and locks it until the
+// transaction carried by ctx ends, so it is the state the writes of the
+// transaction apply to.
+func (r *Repository) Find(ctx context.Context, userID string) (*User, error) {
+	u, err := scan(r.repo.Conn(ctx).QueryRowContext(ctx, "select "+columns+" from users where id = $1 for update", userID))
+	if err != nil {
+		return nil, postgres.WrapError(err, "error while finding user")
+	}
+
+	return u, nil
+}
+
+// find returns the user, deleted or not.
+func (r *Repository) find(ctx context.Context, userID string) (*User, error) {
+	u, err := scan(r.repo.Conn(ctx).QueryRowContext(ctx, "select "+columns+" from users where id = $1", userID))
+	if err != nil {
+		return nil, postgres.WrapError(err, "error while finding user")
+	}
+
+	return u, nil
+}
+
+// columns are the columns scan reads, in order.
+const columns = "id, name, age, email, is_deleted, version, deleted_at, coalesce(deleted_by, ''), created_at, updated_at"
+
+// scan reads a row of columns.
+func scan(row interface{ Scan(dest ...any) error }) (*User, error) {
+	var u User
+	err := row.Scan(&u.ID, &u.Name, &u.Age, &u.Email, &u.IsDeleted, &u.Version, &u.DeletedAt, &u.DeletedBy, &u.CreatedAt, &u.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// Update overwrites the user if it still has user.Version, or regardless of
+// its version when that is zero, and sets user.Version to the new one.
+func (r *Repository) Update(ctx context.Context, user *User) (string, error) {
+	return r.write(ctx, user, []string{"name", "age", "email"})
+}
+
+// Patch writes only patch.Fields of patch.User, under the same version rule
+// as Update, and sets patch.User to the stored result.
+func (r *Repository) Patch(ctx context.Context, patch *Patch) (string, error) {
+	if err := patch.CheckFields(); err != nil {
+		return "", err
+	}
+	return r.write(ctx, &patch.User, patch.Fields)
+}
+
+func (r *Repository) write(ctx context.Context, user *User, fields []string) (string, error) {
+	if len(fields) == 0 {
+		return user.ID, r.current(ctx, user)
+	}
+
+	var (
+		set  []string
+		args = []any{user.ID, user.Version}
+		seen = map[string]bool{}
+	)
+	for _, f := range fields {
+		if seen[f] {
+			continue
+		}
+		seen[f] = true
+
+		args = append(args, user.patchValue(f))
+		set = append(set, fmt.Sprintf("%s = $%d", patchColumns[f], len(args)))
+	}
+
 	query := `
-	select
-		name, age, email
-	from
+	update
 		users
+	set
+		` + strings.Join(set, ", ") + `, version = version + 1, updated_at = now()
 	where
-		id = $1 and is_deleted = false
-	`
+		id = $1 and is_deleted = false and ($2 = 0 or version = $2)
+	returning
+		` + columns
 
-	u := User{ID: userID, IsDeleted: false}
-	err := r.repo.DB.QueryRowContext(ctx, query, userID).Scan(&u.Name, &u.Age, &u.Email)
+	stored, err := scan(r.repo.Conn(ctx).QueryRowContext(ctx, query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", r.unchanged(ctx, user.ID, user.Version)
+	}
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, errors.Wrap(err, "not found")
-		}
+		return "", postgres.WrapError(err, "error while updating user")
+	}
 
-		return nil, errors.Wrap(err, "error while finding user")
+	*user = *stored
+	return user.ID, nil
+}
+
+// current replaces user by the stored one, for writes that change nothing
+// but still expect user.Version.
+func (r *Repository) current(ctx context.Context, user *User) error {
+	stored, err := r.Read(ctx, user.ID)
+	if err != nil {
+		return err
 	}
 
-	return &u, nil
+	if user.Version != 0 && stored.Version != user.Version {
+		return errs.PreconditionFailed(fmt.Sprintf("user is at version %d, not %d", stored.Version, user.Version))
+	}
+
+	*user = *stored
+	return nil
 }
 
-func (r *Repository) Update(ctx context.Context, user *User) (string, error) {
+// Delete flags the user as deleted by deletedBy, keeping it for restoring
+// until it is purged.
+func (r *Repository) Delete(ctx context.Context, userID, deletedBy string) (string, error) {
 	query := `
 	update
 		users
 	set
-		name = $2, age = $3, email = $4
+		is_deleted = true, deleted_at = now(), deleted_by = nullif($2, ''), version = version + 1, updated_at = now()
 	where
 		id = $1 and is_deleted = false
 	`
 
-	_, err := r.repo.DB.ExecContext(ctx, query, user.ID, user.Name, user.Age, user.Email)
+	res, err := r.repo.Conn(ctx).ExecContext(ctx, query, userID, deletedBy)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return "", errors.Wrap(err, "not found")
-		}
-		return "", errors.Wrap(err, "error while updating user")
+		return "", postgres.WrapError(err, "error while deleting user")
 	}
 
-	return user.ID, nil
+	if err := r.checkAffected(ctx, res, userID); err != nil {
+		return "", err
+	}
+
+	return userID, nil
 }
 
-func (r *Repository) Delete(ctx context.Context, userID string) (string, error) {
+// Restore undoes the deletion of the user. It is a conflict if the user is
+// not deleted, or if another user has taken its email since.
+func (r *Repository) Restore(ctx context.Context, userID string) (*User, error) {
 	query := `
 	update
 		users
 	set
-		is_deleted = true
+		is_deleted = false, deleted_at = null, deleted_by = null, version = version + 1, updated_at = now()
 	where
-		id = $1
-	`
+		id = $1 and is_deleted = true
+	returning
+		` + columns
+
+	u, err := scan(r.repo.Conn(ctx).QueryRowContext(ctx, query, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := r.find(ctx, userID); err != nil {
+			return nil, err
+		}
+		return nil, errs.Conflict("user is not deleted")
+	}
+	if err != nil {
+		return nil, postgres.WrapError(err, "error while restoring user")
+	}
+
+	return u, nil
+}
+
+// Purge removes the user for good, deleted or not.
+func (r *Repository) Purge(ctx context.Context, userID string) error {
+	res, err := r.repo.Conn(ctx).ExecContext(ctx, "delete from users where id = $1", userID)
+	if err != nil {
+		return postgres.WrapError(err, "error while purging user")
+	}
 
-	_, err := r.repo.DB.ExecContext(ctx, query, userID)
+	n, err := res.RowsAffected()
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return "", errors.Wrap(err, "not found")
+		return errors.Wrap(err, "error while reading affected rows")
+	}
+
+	if n == 0 {
+		return errs.NotFound("user not found")
+	}
+
+	return nil
+}
+
+// PurgeDeleted removes up to limit users deleted before before, oldest
+// first, and returns them. Rows locked by a concurrent purge are skipped,
+// so instances running it at once do not wait on each other.
+func (r *Repository) PurgeDeleted(ctx context.Context, before time.Time, limit int) ([]*User, error) {
+	query := `
+	delete from
+		users
+	where
+		id in (
+			select
+				id
+			from
+				users
+			where
+				is_deleted = true and deleted_at < $1
+			order by
+				deleted_at
+			limit $2
+			for update skip locked
+		)
+	returning
+		` + columns
+
+	rows, err := r.repo.Conn(ctx).QueryContext(ctx, query, before, limit)
+	if err != nil {
+		return nil, postgres.WrapError(err, "error while purging deleted users")
+	}
+	defer rows.Close()
+
+	var res []*User
+	for rows.Next() {
+		u, err := scan(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "error while scanning purged user")
 		}
-		return "", errors.Wrap(err, "error while deleting user")
+		res = append(res, u)
 	}
 
-	return userID, nil
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error while purging deleted users")
+	}
+
+	return res, nil
+}
+
+// checkAffected explains why a write guarded by is_deleted = false touched
+// no rows: the user is either missing or already deleted.
+func (r *Repository) checkAffected(ctx context.Context, res sql.Result, userID string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "error while reading affected rows")
+	}
+
+	if n > 0 {
+		return nil
+	}
+
+	return r.unchanged(ctx, userID, 0)
+}
+
+// unchanged explains why a guarded write touched no rows: the user is
+// missing, already deleted or, if version is set, at another version.
+func (r *Repository) unchanged(ctx context.Context, userID string, version int) error {
+	if err := r.current(ctx, &User{ID: userID, Version: version}); err != nil {
+		return err
+	}
+	return errors.New("user was not changed")
+}
+
+func (r *Repository) List(ctx context.Context, params *ListParams) (*Page, error) {
+	column, ok := sortColumns[params.SortBy]
+	if !ok {
+		return nil, errs.Validation("unknown sort field: " + params.SortBy)
+	}
+
+	var (
+		where []string
+		args  []any
+	)
+
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if !params.IncludeDeleted {
+		where = append(where, "is_deleted = false")
+	}
+	if params.Name != "" {
+		where = append(where, "name ilike '%' || "+arg(escapeLike(params.Name))+" || '%'")
+	}
+	if params.Email != "" {
+		where = append(where, "email ilike '%' || "+arg(escapeLike(params.Email))+" || '%'")
+	}
+	if params.MinAge > 0 {
+		where = append(where, "age >= "+arg(params.MinAge))
+	}
+	if params.MaxAge > 0 {
+		where = append(where, "age <= "+arg(params.MaxAge))
+	}
+
+	// The total ignores the cursor so it stays the same across pages.
+	var total int
+	countQuery := "select count(*) from users" + whereClause(where)
+	if err := r.repo.Conn(ctx).QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, postgres.WrapError(err, "error while counting users")
+	}
+
+	order, cmp := "asc", ">"
+	if params.SortDesc {
+		order, cmp = "desc", "<"
+	}
+
+	if params.Cursor != "" {
+		c, err := decodeCursor(params.Cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		if column == "id" {
+			where = append(where, "id "+cmp+" "+arg(c.ID))
+		} else {
+			where = append(where, fmt.Sprintf("(%s, id) %s (%s, %s)", column, cmp, arg(c.Value), arg(c.ID)))
+		}
+	}
+
+	orderBy := "id " + order
+	if column != "id" {
+		orderBy = column + " " + order + ", " + orderBy
+	}
+
+	// One extra row tells us whether there is a next page.
+	query := `
+	select
+		` + columns + `
+	from
+		users` + whereClause(where) + `
+	order by ` + orderBy + `
+	limit ` + arg(params.Limit+1)
+
+	rows, err := r.repo.Conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, postgres.WrapError(err, "error while listing users")
+	}
+	defer rows.Close()
+
+	res := make([]*User, 0, params.Limit+1)
+	for rows.Next() {
+		u, err := scan(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "error while scanning user")
+		}
+		res = append(res, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error while listing users")
+	}
+
+	page := &Page{Items: res, Total: total}
+	if len(res) > params.Limit {
+		page.Items = res[:params.Limit]
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = encodeCursor(pageCursor{Value: last.sortValue(params.SortBy), ID: last.ID})
+	}
+
+	return page, nil
+}
+
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return "\n\twhere\n\t\t" + strings.Join(conditions, " and ")
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+type pageCursor struct {
+	Value string `json:"v,omitempty"`
+	ID    string `json:"id"`
+}
+
+func encodeCursor(c pageCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(token string) (*pageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errs.Wrap(errs.KindValidation, err, "invalid cursor")
+	}
+
+	var c pageCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, errs.Wrap(errs.KindValidation, err, "invalid cursor")
+	}
+
+	return &c, nil
 }
@@ -2,8 +2,17 @@ package repository
 
 import (
 	"practice/internal/repository/mongodb"
+	mongoAudit "practice/internal/repository/mongodb/audit"
+	mongoCommand "practice/internal/repository/mongodb/command"
 	"practice/internal/repository/mongodb/computer"
+	mongoOutbox "practice/internal/repository/mongodb/outbox"
+	mongoProcessed "practice/internal/repository/mongodb/processed"
 	"practice/internal/repository/postgres"
+	pgAudit "practice/internal/repository/postgres/audit"
+	pgCommand "practice/internal/repository/postgres/command"
+	pgOutbox "practice/internal/repository/postgres/outbox"
+	pgProcessed "practice/internal/repository/postgres/processed"
+	"practice/internal/repository/postgres/transfer"
 	"practice/internal/repository/postgres/user"
 
 	"go.uber.org/fx"
@@ -14,4 +23,13 @@ var Module = fx.Options(
 	mongodb.Module,
 	user.Module,
 	computer.Module,
+	pgOutbox.Module,
+	mongoOutbox.Module,
+	pgProcessed.Module,
+	mongoProcessed.Module,
+	pgCommand.Module,
+	mongoCommand.Module,
+	pgAudit.Module,
+	mongoAudit.Module,
+	transfer.Module,
 )
@@ -0,0 +1,126 @@
+package retention
+
+import (
+	"context"
+	"log/slog"
+	"practice/internal/pkg/audit"
+	"practice/internal/pkg/bus"
+	"practice/internal/pkg/config"
+	"practice/internal/service/computer"
+	"practice/internal/service/user"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/fx"
+)
+
+var Module = fx.Options(fx.Invoke(New))
+
+type Options struct {
+	fx.In
+	fx.Lifecycle
+	Cfg             *config.Config
+	Logger          *slog.Logger
+	UserService     user.ServiceUser
+	ComputerService computer.ServiceComputer
+}
+
+// purger is the part of a service the job needs.
+type purger interface {
+	PurgeDeleted(ctx context.Context, before time.Time, limit int) (int, error)
+}
+
+// Job purges users and computers deleted longer than RETENTION_PERIOD ago,
+// every RETENTION_INTERVAL. Every instance runs it; purges skip what
+// another instance is purging at the same time.
+type Job struct {
+	cfg     *config.Config
+	logger  *slog.Logger
+	purgers map[string]purger
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func New(opts Options) (*Job, error) {
+	job := &Job{
+		cfg:    opts.Cfg,
+		logger: opts.Logger,
+		purgers: map[string]purger{
+			"users":     opts.UserService,
+			"computers": opts.ComputerService,
+		},
+	}
+
+	if opts.Cfg.RETENTION_PERIOD <= 0 {
+		opts.Logger.Info("retention of deleted records disabled")
+		return job, nil
+	}
+	if opts.Cfg.RETENTION_INTERVAL <= 0 {
+		return nil, errors.New("RETENTION_INTERVAL must be positive")
+	}
+
+	opts.Lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			ctx := bus.WithActor(context.Background(), bus.ActorSystem)
+			ctx, cancel := context.WithCancel(audit.WithSource(ctx, audit.SourceSystem))
+			job.cancel = cancel
+
+			job.wg.Add(1)
+			go job.run(ctx)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			job.cancel()
+			job.wg.Wait()
+			return nil
+		},
+	})
+
+	return job, nil
+}
+
+func (j *Job) run(ctx context.Context) {
+	defer j.wg.Done()
+
+	ticker := time.NewTicker(j.cfg.RETENTION_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		j.purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purge removes everything past retention in batches, one transaction each.
+func (j *Job) purge(ctx context.Context) {
+	before := time.Now().Add(-j.cfg.RETENTION_PERIOD)
+	batch := max(j.cfg.RETENTION_BATCH_SIZE, 1)
+
+	for name, p := range j.purgers {
+		total := 0
+		for ctx.Err() == nil {
+			n, err := p.PurgeDeleted(ctx, before, batch)
+			if err != nil {
+				if ctx.Err() == nil {
+					j.logger.Error("retention purge failed", "records", name, "error", err.Error())
+				}
+				break
+			}
+
+			total += n
+			if n < batch {
+				break
+			}
+		}
+
+		if total > 0 {
+			j.logger.Info("purged deleted records", "records", name, "count", total, "deletedBefore", before)
+		}
+	}
+}
@@ -2,31 +2,79 @@ package computer
 
 import (
 	"context"
-	"errors"
 	"log/slog"
+	"practice/internal/pkg/audit"
+	"practice/internal/pkg/bus"
+	"practice/internal/pkg/command"
+	"practice/internal/pkg/config"
+	"practice/internal/pkg/dedup"
+	"practice/internal/pkg/errs"
+	"practice/internal/pkg/event"
+	"practice/internal/pkg/validator"
+	"practice/internal/repository/mongodb"
+	auditRepo "practice/internal/repository/mongodb/audit"
+	cmdRepo "practice/internal/repository/mongodb/command"
 	"practice/internal/repository/mongodb/computer"
+	"practice/internal/repository/mongodb/outbox"
+	"practice/internal/repository/mongodb/processed"
+	"practice/internal/repository/postgres"
+	"practice/internal/repository/postgres/user"
+	"slices"
+	"time"
 
 	"go.uber.org/fx"
 )
 
 var Module = fx.Provide(New)
 
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
 type Options struct {
 	fx.In
+	Cfg    *config.Config
 	Logger *slog.Logger
 
-	ComputerRepository computer.RepositoryComputer
+	Mongo               *mongodb.MongoDB
+	ComputerRepository  computer.RepositoryComputer
+	OutboxRepository    outbox.RepositoryOutbox
+	ProcessedRepository processed.RepositoryProcessed
+	CommandRepository   cmdRepo.RepositoryCommand
+	AuditRepository     auditRepo.RepositoryAudit
+
+	// Owners are users, kept in Postgres.
+	Postgres       *postgres.Postgres
+	UserRepository user.RepositoryUser
 }
 
 type Service struct {
 	logger       *slog.Logger
+	mongo        *mongodb.MongoDB
 	repoComputer computer.RepositoryComputer
+	events       *event.Publisher
+	processed    processed.RepositoryProcessed
+	commands     cmdRepo.RepositoryCommand
+	audit        auditRepo.RepositoryAudit
+	postgres     *postgres.Postgres
+	repoUser     user.RepositoryUser
 }
 
 func New(opts Options) ServiceComputer {
 	return &Service{
 		logger:       opts.Logger,
+		mongo:        opts.Mongo,
 		repoComputer: opts.ComputerRepository,
+		events: event.NewPublisher(
+			opts.OutboxRepository,
+			event.Destinations(opts.Cfg, opts.Cfg.KAFKA_TOPIC_COMPUTER_EVENTS),
+		),
+		processed: opts.ProcessedRepository,
+		commands:  opts.CommandRepository,
+		audit:     opts.AuditRepository,
+		postgres:  opts.Postgres,
+		repoUser:  opts.UserRepository,
 	}
 }
 
@@ -34,86 +82,398 @@ type ServiceComputer interface {
 	Create(ctx context.Context, computer *computer.Computer) (*computer.Computer, error)
 	Read(ctx context.Context, compID string) (*computer.Computer, error)
 	Update(ctx context.Context, computer *computer.Computer) (string, error)
+	Patch(ctx context.Context, patch *computer.Patch) (string, error)
 	Delete(ctx context.Context, compID string) (string, error)
-	GetAll(ctx context.Context) ([]*computer.Computer, error)
+	Assign(ctx context.Context, compID, ownerID string, version int) (*computer.Computer, error)
+	Reassign(ctx context.Context, from, to string) (int, error)
+	Restore(ctx context.Context, compID string) (*computer.Computer, error)
+	Purge(ctx context.Context, compID string) error
+	PurgeDeleted(ctx context.Context, before time.Time, limit int) (int, error)
+	List(ctx context.Context, params *computer.ListParams) (*computer.Page, error)
+	History(ctx context.Context, compID string, params *audit.ListParams) (*audit.Page, error)
 }
 
 func (s *Service) Create(ctx context.Context, computer *computer.Computer) (*computer.Computer, error) {
-	if !s.validComputer(computer) {
-		return nil, errors.New("invalid computer")
+	if err := validator.Struct(computer); err != nil {
+		return nil, err
+	}
+
+	err := s.withOwner(ctx, computer.OwnerID, func(ctx context.Context) error {
+		return s.mongo.Tx(ctx, func(ctx context.Context) error {
+			if err := dedup.Record(ctx, s.processed); err != nil {
+				return err
+			}
+			if _, err := s.repoComputer.Create(ctx, computer); err != nil {
+				return err
+			}
+			if err := s.record(ctx, audit.ActionCreated, nil, computer); err != nil {
+				return err
+			}
+			if err := command.Complete(ctx, s.commands, computer.ID.Hex()); err != nil {
+				return err
+			}
+			return s.events.Publish(ctx, event.ComputerCreated, computer.ID.Hex(), computer.Version, computer)
+		})
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return s.repoComputer.Create(ctx, computer)
+	return computer, nil
 }
 
 func (s *Service) Read(ctx context.Context, compID string) (*computer.Computer, error) {
 	if compID == "" {
-		return nil, errors.New("computerID not exists")
+		return nil, errs.Validation("computerID not exists")
 	}
 
 	return s.repoComputer.Read(ctx, compID)
 }
 
 func (s *Service) Update(ctx context.Context, computer *computer.Computer) (string, error) {
-	if !s.validComputer(computer) || computer.ID == nil {
-		return "", errors.New("invalid computer")
+	if computer != nil && computer.ID == nil {
+		return "", errs.Invalid("invalid computer", errs.FieldError{Field: "_id", Message: "is required"})
+	}
+
+	if err := validator.Struct(computer); err != nil {
+		return "", err
+	}
+
+	err := s.withOwner(ctx, computer.OwnerID, func(ctx context.Context) error {
+		return s.mongo.Tx(ctx, func(ctx context.Context) error {
+			if err := dedup.Record(ctx, s.processed); err != nil {
+				return err
+			}
+			before, err := s.repoComputer.Find(ctx, computer.ID.Hex())
+			if err != nil {
+				return err
+			}
+			if _, err := s.repoComputer.Update(ctx, computer); err != nil {
+				return err
+			}
+			if err := s.record(ctx, audit.ActionUpdated, before, computer); err != nil {
+				return err
+			}
+			if err := command.Complete(ctx, s.commands, computer.ID.Hex()); err != nil {
+				return err
+			}
+			return s.events.Publish(ctx, event.ComputerUpdated, computer.ID.Hex(), computer.Version, computer)
+		})
+	})
+	if err != nil {
+		return "", err
 	}
 
-	return s.repoComputer.Update(ctx, computer)
+	return computer.ID.Hex(), nil
+}
+
+// Patch validates the merged computer, writes the patched fields and
+// publishes the resulting computer if it changed.
+func (s *Service) Patch(ctx context.Context, patch *computer.Patch) (string, error) {
+	if patch.ID == nil {
+		return "", errs.Invalid("invalid computer", errs.FieldError{Field: "_id", Message: "is required"})
+	}
+
+	if err := validator.Struct(&patch.Computer); err != nil {
+		return "", err
+	}
+
+	// Only patches of the owner check it: the others keep the one they have.
+	ownerID := ""
+	if slices.Contains(patch.Fields, "ownerId") {
+		ownerID = patch.OwnerID
+	}
+
+	err := s.withOwner(ctx, ownerID, func(ctx context.Context) error {
+		return s.mongo.Tx(ctx, func(ctx context.Context) error {
+			if err := dedup.Record(ctx, s.processed); err != nil {
+				return err
+			}
+			before, err := s.repoComputer.Find(ctx, patch.ID.Hex())
+			if err != nil {
+				return err
+			}
+			if _, err := s.repoComputer.Patch(ctx, patch); err != nil {
+				return err
+			}
+			if err := command.Complete(ctx, s.commands, patch.ID.Hex()); err != nil {
+				return err
+			}
+			// Patches that write nothing leave the version, no history and
+			// no event.
+			if patch.Version == before.Version {
+				return nil
+			}
+			if err := s.record(ctx, audit.ActionUpdated, before, &patch.Computer); err != nil {
+				return err
+			}
+			return s.events.Publish(ctx, event.ComputerUpdated, patch.ID.Hex(), patch.Version, &patch.Computer)
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return patch.ID.Hex(), nil
 }
 
 func (s *Service) Delete(ctx context.Context, compID string) (string, error) {
 	if compID == "" {
-		return "", errors.New("computerID not exists")
+		return "", errs.Validation("computerID not exists")
+	}
+
+	err := s.mongo.Tx(ctx, func(ctx context.Context) error {
+		if err := dedup.Record(ctx, s.processed); err != nil {
+			return err
+		}
+		before, err := s.repoComputer.Find(ctx, compID)
+		if err != nil {
+			return err
+		}
+		if _, err := s.repoComputer.Delete(ctx, compID, bus.Actor(ctx)); err != nil {
+			return err
+		}
+		after, err := s.repoComputer.Find(ctx, compID)
+		if err != nil {
+			return err
+		}
+		if err := s.record(ctx, audit.ActionDeleted, before, after); err != nil {
+			return err
+		}
+		if err := command.Complete(ctx, s.commands, compID); err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event.ComputerDeleted, compID, after.Version, event.Deleted{ID: compID})
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return compID, nil
+}
+
+// Assign gives the computer to the user ownerID, or unassigns it if ownerID
+// is empty, if it still has version or regardless of its version when that
+// is zero.
+func (s *Service) Assign(ctx context.Context, compID, ownerID string, version int) (*computer.Computer, error) {
+	if compID == "" {
+		return nil, errs.Validation("computerID not exists")
+	}
+
+	var res *computer.Computer
+	err := s.withOwner(ctx, ownerID, func(ctx context.Context) error {
+		return s.mongo.Tx(ctx, func(ctx context.Context) error {
+			before, err := s.repoComputer.Find(ctx, compID)
+			if err != nil {
+				return err
+			}
+			if res, err = s.repoComputer.SetOwner(ctx, compID, ownerID, version); err != nil {
+				return err
+			}
+			if err := s.record(ctx, audit.ActionUpdated, before, res); err != nil {
+				return err
+			}
+			return s.events.Publish(ctx, event.ComputerUpdated, compID, res.Version, res)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Reassign gives all the computers of the user from, deleted ones
+// included, to the user to, or unassigns them if to is empty, and returns
+// how many it changed. It does not check to: the caller holds the owner
+// as Assign does. Reassigning computers that already moved changes
+// nothing, so it may be retried.
+func (s *Service) Reassign(ctx context.Context, from, to string) (int, error) {
+	if from == "" {
+		return 0, errs.Validation("userID not exists")
+	}
+
+	var owned []*computer.Computer
+	err := s.mongo.Tx(ctx, func(ctx context.Context) error {
+		var err error
+		if owned, err = s.repoComputer.Owned(ctx, from); err != nil {
+			return err
+		}
+
+		for _, before := range owned {
+			id := before.ID.Hex()
+			after, err := s.repoComputer.SetOwner(ctx, id, to, before.Version)
+			if err != nil {
+				return err
+			}
+			if err := s.record(ctx, audit.ActionUpdated, before, after); err != nil {
+				return err
+			}
+			if err := s.events.Publish(ctx, event.ComputerUpdated, id, after.Version, after); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(owned), nil
+}
+
+// Restore undoes the deletion of a computer.
+func (s *Service) Restore(ctx context.Context, compID string) (*computer.Computer, error) {
+	if compID == "" {
+		return nil, errs.Validation("computerID not exists")
+	}
+
+	var res *computer.Computer
+	err := s.mongo.Tx(ctx, func(ctx context.Context) error {
+		before, err := s.repoComputer.Find(ctx, compID)
+		if err != nil {
+			return err
+		}
+		if res, err = s.repoComputer.Restore(ctx, compID); err != nil {
+			return err
+		}
+		if err := s.record(ctx, audit.ActionRestored, before, res); err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event.ComputerRestored, compID, res.Version, res)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return s.repoComputer.Delete(ctx, compID)
+	return res, nil
 }
 
-func (s *Service) GetAll(ctx context.Context) ([]*computer.Computer, error) {
-	return s.repoComputer.GetAll(ctx)
+// Purge removes a computer for good, whether deleted or not.
+func (s *Service) Purge(ctx context.Context, compID string) error {
+	if compID == "" {
+		return errs.Validation("computerID not exists")
+	}
+
+	return s.mongo.Tx(ctx, func(ctx context.Context) error {
+		before, err := s.repoComputer.Find(ctx, compID)
+		if err != nil {
+			return err
+		}
+		if err := s.repoComputer.Purge(ctx, compID); err != nil {
+			return err
+		}
+		if err := s.record(ctx, audit.ActionPurged, before, nil); err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event.ComputerPurged, compID, before.Version, event.Deleted{ID: compID})
+	})
 }
 
-func (s *Service) validComputer(computer *computer.Computer) bool {
-	if computer == nil {
-		s.logger.Error("computer is nil")
-		return false
+// PurgeDeleted removes up to limit computers deleted before before and
+// returns how many it removed.
+func (s *Service) PurgeDeleted(ctx context.Context, before time.Time, limit int) (int, error) {
+	var purged []*computer.Computer
+	err := s.mongo.Tx(ctx, func(ctx context.Context) error {
+		var err error
+		if purged, err = s.repoComputer.PurgeDeleted(ctx, before, limit); err != nil {
+			return err
+		}
+
+		for _, c := range purged {
+			if err := s.record(ctx, audit.ActionPurged, c, nil); err != nil {
+				return err
+			}
+			id := c.ID.Hex()
+			if err := s.events.Publish(ctx, event.ComputerPurged, id, c.Version, event.Deleted{ID: id}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	if computer.IP == "" {
-		s.logger.Error("computer.IP not exists")
-		return false
+	return len(purged), nil
+}
+
+func (s *Service) List(ctx context.Context, params *computer.ListParams) (*computer.Page, error) {
+	if params == nil {
+		params = &computer.ListParams{}
+	}
+
+	if params.Limit <= 0 {
+		params.Limit = defaultListLimit
+	}
+
+	if params.Limit > maxListLimit {
+		params.Limit = maxListLimit
 	}
 
-	if computer.Manufacturer == "" {
-		s.logger.Error("computer.Manufacturer not exists")
-		return false
+	if params.SortBy == "" {
+		params.SortBy = "id"
 	}
 
-	if computer.CPU == "" {
-		s.logger.Error("computer.CPU not exists")
-		return false
+	if !computer.IsSortable(params.SortBy) {
+		return nil, errs.Validation("unknown sort field")
 	}
 
-	if computer.RAM == "" {
-		s.logger.Error("computer.RAM not exists")
-		return false
+	return s.repoComputer.List(ctx, params)
+}
+
+// History returns a page of the changes to a computer, newest first. The
+// history of purged computers is kept.
+func (s *Service) History(ctx context.Context, compID string, params *audit.ListParams) (*audit.Page, error) {
+	if compID == "" {
+		return nil, errs.Validation("computerID not exists")
 	}
 
-	if computer.HDD == "" {
-		s.logger.Error("computer.HDD not exists")
-		return false
+	if params == nil {
+		params = &audit.ListParams{}
 	}
 
-	if computer.GPU == "" {
-		s.logger.Error("computer.GPU not exists")
-		return false
+	if params.Limit <= 0 {
+		params.Limit = defaultListLimit
 	}
 
-	if computer.OS == "" {
-		s.logger.Error("computer.OS not exists")
-		return false
+	if params.Limit > maxListLimit {
+		params.Limit = maxListLimit
 	}
 
-	return true
+	return s.audit.List(ctx, audit.EntityComputer, compID, params)
+}
+
+// withOwner runs fn once it made sure the user ownerID, if any, exists and
+// is not deleted. Users live in Postgres, so the user stays locked until fn
+// returns: it cannot be deleted, and its computers queued for transfer,
+// while fn assigns it one.
+func (s *Service) withOwner(ctx context.Context, ownerID string, fn func(ctx context.Context) error) error {
+	if ownerID == "" {
+		return fn(ctx)
+	}
+
+	return s.postgres.Tx(ctx, func(ctx context.Context) error {
+		owner, err := s.repoUser.Find(ctx, ownerID)
+		if errs.Is(err, errs.KindNotFound) || errs.Is(err, errs.KindValidation) {
+			return errs.Invalid("invalid computer", errs.FieldError{Field: "ownerId", Message: "no such user"})
+		}
+		if err != nil {
+			return err
+		}
+		if owner.IsDeleted {
+			return errs.Invalid("invalid computer", errs.FieldError{Field: "ownerId", Message: "user is deleted"})
+		}
+		return fn(ctx)
+	})
+}
+
+// record appends the change of a computer from before to after to the
+// audit log, in the transaction carried by ctx.
+func (s *Service) record(ctx context.Context, action audit.Action, before, after *computer.Computer) error {
+	changed := after
+	if changed == nil {
+		changed = before
+	}
+	return audit.Record(ctx, s.audit, audit.EntityComputer, action, changed.ID.Hex(), changed.Version, before, after)
 }
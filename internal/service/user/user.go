@@ -2,31 +2,72 @@ package user
 
 import (
 	"context"
-	"errors"
 	"log/slog"
+	"practice/internal/pkg/audit"
+	"practice/internal/pkg/bus"
+	"practice/internal/pkg/command"
+	"practice/internal/pkg/config"
+	"practice/internal/pkg/dedup"
+	"practice/internal/pkg/errs"
+	"practice/internal/pkg/event"
+	"practice/internal/pkg/validator"
+	"practice/internal/repository/postgres"
+	auditRepo "practice/internal/repository/postgres/audit"
+	cmdRepo "practice/internal/repository/postgres/command"
+	"practice/internal/repository/postgres/outbox"
+	"practice/internal/repository/postgres/processed"
+	"practice/internal/repository/postgres/transfer"
 	"practice/internal/repository/postgres/user"
+	"time"
 
 	"go.uber.org/fx"
 )
 
 var Module = fx.Provide(New)
 
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
 type Options struct {
 	fx.In
+	Cfg    *config.Config
 	Logger *slog.Logger
 
-	UserRepository user.RepositoryUser
+	Postgres            *postgres.Postgres
+	UserRepository      user.RepositoryUser
+	OutboxRepository    outbox.RepositoryOutbox
+	ProcessedRepository processed.RepositoryProcessed
+	CommandRepository   cmdRepo.RepositoryCommand
+	AuditRepository     auditRepo.RepositoryAudit
+	TransferRepository  transfer.RepositoryTransfer
 }
 
 type Service struct {
-	logger   *slog.Logger
-	repoUser user.RepositoryUser
+	logger    *slog.Logger
+	postgres  *postgres.Postgres
+	repoUser  user.RepositoryUser
+	events    *event.Publisher
+	processed processed.RepositoryProcessed
+	commands  cmdRepo.RepositoryCommand
+	audit     auditRepo.RepositoryAudit
+	transfers transfer.RepositoryTransfer
 }
 
 func New(opts Options) ServiceUser {
 	return &Service{
 		logger:   opts.Logger,
+		postgres: opts.Postgres,
 		repoUser: opts.UserRepository,
+		events: event.NewPublisher(
+			opts.OutboxRepository,
+			event.Destinations(opts.Cfg, opts.Cfg.KAFKA_TOPIC_USER_EVENTS),
+		),
+		processed: opts.ProcessedRepository,
+		commands:  opts.CommandRepository,
+		audit:     opts.AuditRepository,
+		transfers: opts.TransferRepository,
 	}
 }
 
@@ -34,66 +75,341 @@ type ServiceUser interface {
 	Create(ctx context.Context, user *user.User) (*user.User, error)
 	Read(ctx context.Context, userID string) (*user.User, error)
 	Update(ctx context.Context, user *user.User) (string, error)
-	Delete(ctx context.Context, userID string) (string, error)
+	Patch(ctx context.Context, patch *user.Patch) (string, error)
+	Delete(ctx context.Context, userID, reassignTo string) (string, error)
+	Restore(ctx context.Context, userID string) (*user.User, error)
+	Purge(ctx context.Context, userID string) error
+	PurgeDeleted(ctx context.Context, before time.Time, limit int) (int, error)
+	List(ctx context.Context, params *user.ListParams) (*user.Page, error)
+	History(ctx context.Context, userID string, params *audit.ListParams) (*audit.Page, error)
 }
 
 func (s *Service) Create(ctx context.Context, user *user.User) (*user.User, error) {
-	if !s.validUser(user) {
-		return nil, errors.New("invalid user")
+	if err := validator.Struct(user); err != nil {
+		return nil, err
+	}
+
+	err := s.postgres.Tx(ctx, func(ctx context.Context) error {
+		if err := dedup.Record(ctx, s.processed); err != nil {
+			return err
+		}
+		if _, err := s.repoUser.Create(ctx, user); err != nil {
+			return err
+		}
+		if err := s.record(ctx, audit.ActionCreated, nil, user); err != nil {
+			return err
+		}
+		if err := command.Complete(ctx, s.commands, user.ID); err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event.UserCreated, user.ID, user.Version, user)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return s.repoUser.Create(ctx, user)
+	return user, nil
 }
 
 func (s *Service) Read(ctx context.Context, userID string) (*user.User, error) {
 	if userID == "" {
-		return nil, errors.New("userID not exists")
+		return nil, errs.Validation("userID not exists")
 	}
 
 	return s.repoUser.Read(ctx, userID)
 }
 
 func (s *Service) Update(ctx context.Context, user *user.User) (string, error) {
-	if !s.validUser(user) {
-		return "", errors.New("invalid user")
+	if err := validator.Struct(user); err != nil {
+		return "", err
+	}
+
+	err := s.postgres.Tx(ctx, func(ctx context.Context) error {
+		if err := dedup.Record(ctx, s.processed); err != nil {
+			return err
+		}
+		before, err := s.repoUser.Find(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		if _, err := s.repoUser.Update(ctx, user); err != nil {
+			return err
+		}
+		if err := s.record(ctx, audit.ActionUpdated, before, user); err != nil {
+			return err
+		}
+		if err := command.Complete(ctx, s.commands, user.ID); err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event.UserUpdated, user.ID, user.Version, user)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return user.ID, nil
+}
+
+// Patch validates the merged user, writes the patched fields and publishes
+// the resulting user if it changed.
+func (s *Service) Patch(ctx context.Context, patch *user.Patch) (string, error) {
+	if err := validator.Struct(&patch.User); err != nil {
+		return "", err
+	}
+
+	err := s.postgres.Tx(ctx, func(ctx context.Context) error {
+		if err := dedup.Record(ctx, s.processed); err != nil {
+			return err
+		}
+		before, err := s.repoUser.Find(ctx, patch.ID)
+		if err != nil {
+			return err
+		}
+		if _, err := s.repoUser.Patch(ctx, patch); err != nil {
+			return err
+		}
+		if err := command.Complete(ctx, s.commands, patch.ID); err != nil {
+			return err
+		}
+		// Patches that write nothing leave the version, no history and no
+		// event.
+		if patch.Version == before.Version {
+			return nil
+		}
+		if err := s.record(ctx, audit.ActionUpdated, before, &patch.User); err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event.UserUpdated, patch.ID, patch.Version, &patch.User)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return patch.ID, nil
+}
+
+// Delete flags the user as deleted and queues the transfer of its computers
+// to reassignTo, or their unassignment if it is empty, in the same
+// transaction. The transfer is applied later, see package ownership.
+func (s *Service) Delete(ctx context.Context, userID, reassignTo string) (string, error) {
+	if userID == "" {
+		return "", errs.Validation("userID not exists")
+	}
+
+	// reassignTo becomes the ownerId of computers, so it obeys the same rules.
+	reassign := struct {
+		ReassignTo string `json:"reassignTo" validate:"uuid"`
+	}{reassignTo}
+	if err := validator.Struct(reassign); err != nil {
+		return "", err
+	}
+
+	if reassignTo == userID {
+		return "", errs.Invalid("invalid reassignment", errs.FieldError{Field: "reassignTo", Message: "is the deleted user"})
+	}
+
+	err := s.postgres.Tx(ctx, func(ctx context.Context) error {
+		if err := dedup.Record(ctx, s.processed); err != nil {
+			return err
+		}
+		before, err := s.repoUser.Find(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if reassignTo != "" {
+			if err := s.checkOwner(ctx, reassignTo); err != nil {
+				return err
+			}
+		}
+		if _, err := s.repoUser.Delete(ctx, userID, bus.Actor(ctx)); err != nil {
+			return err
+		}
+		if err := s.queueTransfer(ctx, userID, reassignTo); err != nil {
+			return err
+		}
+		after, err := s.repoUser.Find(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if err := s.record(ctx, audit.ActionDeleted, before, after); err != nil {
+			return err
+		}
+		if err := command.Complete(ctx, s.commands, userID); err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event.UserDeleted, userID, after.Version, event.Deleted{ID: userID})
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return userID, nil
+}
+
+// Restore undoes the deletion of a user.
+func (s *Service) Restore(ctx context.Context, userID string) (*user.User, error) {
+	if userID == "" {
+		return nil, errs.Validation("userID not exists")
+	}
+
+	var res *user.User
+	err := s.postgres.Tx(ctx, func(ctx context.Context) error {
+		before, err := s.repoUser.Find(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if res, err = s.repoUser.Restore(ctx, userID); err != nil {
+			return err
+		}
+		if err := s.record(ctx, audit.ActionRestored, before, res); err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event.UserRestored, userID, res.Version, res)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return s.repoUser.Update(ctx, user)
+	return res, nil
 }
 
-func (s *Service) Delete(ctx context.Context, userID string) (string, error) {
+// Purge removes a user for good, whether deleted or not.
+func (s *Service) Purge(ctx context.Context, userID string) error {
 	if userID == "" {
-		return "", errors.New("userID not exists")
+		return errs.Validation("userID not exists")
+	}
+
+	return s.postgres.Tx(ctx, func(ctx context.Context) error {
+		before, err := s.repoUser.Find(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if err := s.repoUser.Purge(ctx, userID); err != nil {
+			return err
+		}
+		// Deleted users had their computers transferred when deleted.
+		if !before.IsDeleted {
+			if err := s.queueTransfer(ctx, userID, ""); err != nil {
+				return err
+			}
+		}
+		if err := s.record(ctx, audit.ActionPurged, before, nil); err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, event.UserPurged, userID, before.Version, event.Deleted{ID: userID})
+	})
+}
+
+// PurgeDeleted removes up to limit users deleted before before and
+// returns how many it removed.
+func (s *Service) PurgeDeleted(ctx context.Context, before time.Time, limit int) (int, error) {
+	var purged []*user.User
+	err := s.postgres.Tx(ctx, func(ctx context.Context) error {
+		var err error
+		if purged, err = s.repoUser.PurgeDeleted(ctx, before, limit); err != nil {
+			return err
+		}
+
+		for _, u := range purged {
+			if err := s.record(ctx, audit.ActionPurged, u, nil); err != nil {
+				return err
+			}
+			if err := s.events.Publish(ctx, event.UserPurged, u.ID, u.Version, event.Deleted{ID: u.ID}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	return s.repoUser.Delete(ctx, userID)
+	return len(purged), nil
 }
 
-func (s *Service) validUser(user *user.User) bool {
-	if user == nil {
-		s.logger.Error("user is nil")
-		return false
+func (s *Service) List(ctx context.Context, params *user.ListParams) (*user.Page, error) {
+	if params == nil {
+		params = &user.ListParams{}
+	}
+
+	if params.Limit <= 0 {
+		params.Limit = defaultListLimit
 	}
 
-	if user.ID == "" {
-		s.logger.Error("user.ID not exists")
-		return false
+	if params.Limit > maxListLimit {
+		params.Limit = maxListLimit
 	}
 
-	if user.Name == "" {
-		s.logger.Error("user.Name not exists")
-		return false
+	if params.SortBy == "" {
+		params.SortBy = "id"
 	}
 
-	if user.Age < 1 {
-		s.logger.Error("user.Age not exists")
-		return false
+	if !user.IsSortable(params.SortBy) {
+		return nil, errs.Validation("unknown sort field")
+	}
+
+	if params.MinAge < 0 || params.MaxAge < 0 || (params.MaxAge > 0 && params.MinAge > params.MaxAge) {
+		return nil, errs.Validation("invalid age range")
+	}
+
+	return s.repoUser.List(ctx, params)
+}
+
+// History returns a page of the changes to a user, newest first. The
+// history of purged users is kept.
+func (s *Service) History(ctx context.Context, userID string, params *audit.ListParams) (*audit.Page, error) {
+	if userID == "" {
+		return nil, errs.Validation("userID not exists")
 	}
 
-	if user.Email == "" {
-		s.logger.Error("user.Email not exists")
-		return false
+	if params == nil {
+		params = &audit.ListParams{}
 	}
 
-	return true
+	if params.Limit <= 0 {
+		params.Limit = defaultListLimit
+	}
+
+	if params.Limit > maxListLimit {
+		params.Limit = maxListLimit
+	}
+
+	return s.audit.List(ctx, audit.EntityUser, userID, params)
+}
+
+// checkOwner fails unless the user reassignTo exists and is not deleted, and
+// locks it until the transaction carried by ctx ends so it stays so.
+func (s *Service) checkOwner(ctx context.Context, reassignTo string) error {
+	owner, err := s.repoUser.Find(ctx, reassignTo)
+	if errs.Is(err, errs.KindNotFound) || errs.Is(err, errs.KindValidation) {
+		return errs.Invalid("invalid reassignment", errs.FieldError{Field: "reassignTo", Message: "no such user"})
+	}
+	if err != nil {
+		return err
+	}
+	if owner.IsDeleted {
+		return errs.Invalid("invalid reassignment", errs.FieldError{Field: "reassignTo", Message: "user is deleted"})
+	}
+	return nil
+}
+
+// queueTransfer queues the transfer of the computers of the user from to
+// the user to, in the transaction carried by ctx.
+func (s *Service) queueTransfer(ctx context.Context, from, to string) error {
+	return s.transfers.Add(ctx, &transfer.Transfer{
+		From:      from,
+		To:        to,
+		Actor:     bus.Actor(ctx),
+		RequestID: bus.CorrelationID(ctx),
+	})
+}
+
+// record appends the change of a user from before to after to the audit
+// log, in the transaction carried by ctx.
+func (s *Service) record(ctx context.Context, action audit.Action, before, after *user.User) error {
+	changed := after
+	if changed == nil {
+		changed = before
+	}
+	return audit.Record(ctx, s.audit, audit.EntityUser, action, changed.ID, changed.Version, before, after)
 }
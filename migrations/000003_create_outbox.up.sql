@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS outbox (
+    id UUID PRIMARY KEY,
+    transport VARCHAR(20) NOT NULL,
+    topic VARCHAR(255) NOT NULL DEFAULT '',
+    msg_key VARCHAR(255) NOT NULL DEFAULT '',
+    headers JSONB NOT NULL DEFAULT '{}',
+    payload BYTEA NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    sent_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (created_at) WHERE sent_at IS NULL;
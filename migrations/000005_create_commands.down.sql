@@ -0,0 +1 @@
+DROP TABLE IF EXISTS commands;
\ No newline at end of file
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS commands (
+    id VARCHAR(255) PRIMARY KEY,
+    type VARCHAR(50) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL,
+    entity_id VARCHAR(255) NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
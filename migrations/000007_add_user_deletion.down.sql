@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS users_deleted_at_idx;
+
+-- Fails if a deleted user shares its email with another user.
+DROP INDEX IF EXISTS users_email_active_key;
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_by;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,11 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(255);
+
+-- Users deleted before the deletion time was recorded start their retention period now.
+UPDATE users SET deleted_at = now() WHERE is_deleted AND deleted_at IS NULL;
+
+-- Deleted users keep their email without blocking new users from taking it.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_active_key ON users (email) WHERE is_deleted IS NOT TRUE;
+
+CREATE INDEX IF NOT EXISTS users_deleted_at_idx ON users (deleted_at) WHERE is_deleted;
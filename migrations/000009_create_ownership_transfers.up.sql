@@ -0,0 +1,16 @@
+-- Computers live in MongoDB, so deleting a user queues the transfer of its
+-- computers in the same transaction and a job applies it there.
+CREATE TABLE IF NOT EXISTS ownership_transfers (
+    id UUID PRIMARY KEY,
+    from_user_id VARCHAR(255) NOT NULL,
+    to_user_id VARCHAR(255) NOT NULL DEFAULT '',
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    request_id VARCHAR(255) NOT NULL DEFAULT '',
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    done_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS ownership_transfers_pending_idx ON ownership_transfers (next_attempt_at) WHERE done_at IS NULL;
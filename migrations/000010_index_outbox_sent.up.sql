@@ -0,0 +1,2 @@
+-- The relay purges sent messages once they are older than the retention.
+CREATE INDEX IF NOT EXISTS outbox_sent_idx ON outbox (sent_at) WHERE sent_at IS NOT NULL;